@@ -15,10 +15,12 @@ require (
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
 	github.com/valyala/fasthttp v1.40.0 // indirect
 	github.com/valyala/tcplisten v1.0.0 // indirect
-	golang.org/x/sys v0.0.0-20220811171246-fbc7d0a398ab // indirect
+	golang.org/x/sys v0.10.0 // indirect
 )
 
 require (
-	github.com/joho/godotenv v1.4.0 // indirect
-	gopkg.in/guregu/null.v4 v4.0.0 // indirect
+	github.com/joho/godotenv v1.4.0
+	github.com/mattn/go-sqlite3 v1.14.16
+	golang.org/x/text v0.13.0
+	gopkg.in/guregu/null.v4 v4.0.0
 )
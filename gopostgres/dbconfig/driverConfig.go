@@ -1,6 +1,8 @@
 package dbconfig
 
 import (
+	"time"
+
 	pq "github.com/lib/pq"
 	"gopkg.in/guregu/null.v4"
 )
@@ -14,48 +16,167 @@ type BanlistDB struct {
 }
 
 type Card struct {
-	ID                    int            `json:"id"`
-	Card_Name             string         `json:"card_name"`
-	Card_Type             string         `json:"card_type"`
-	Description           string         `json:"description"`
-	Archetype             string         `json:"archetype"`
-	Atk                   null.Int       `json:"atk"`
-	Def                   null.Int       `json:"def"`
-	Card_Level            null.Int       `json:"card_level"`
-	Race                  null.String    `json:"race"`
-	Attr                  null.String    `json:"attribute"`
-	Linkval               null.Int       `json:"linkval"`
-	Linkmarkers           pq.StringArray `json:"linkmarkers"`
-	Card_Scale            null.Int       `json:"card_scale"`
-	Image_url_uint8       []byte
-	Image_url_small_uint8 []byte
-	Image_url             []string          `json:"image_url"`
-	Image_url_small       []string          `json:"image_url_small"`
-	BanlistInfoString     null.String       `json:"banlist_info_string"`
-	BanlistInfo           map[string]string `json:"banlist_info"`
+	ID                int               `json:"id"`
+	Card_Name         string            `json:"card_name"`
+	Card_Type         string            `json:"card_type"`
+	Description       string            `json:"description"`
+	Archetype         string            `json:"archetype"`
+	Atk               null.Int          `json:"atk"`
+	Def               null.Int          `json:"def"`
+	Card_Level        null.Int          `json:"card_level"`
+	Race              null.String       `json:"race"`
+	Attr              null.String       `json:"attribute"`
+	Linkval           null.Int          `json:"linkval"`
+	Linkmarkers       pq.StringArray    `json:"linkmarkers"`
+	Card_Scale        null.Int          `json:"card_scale"`
+	FrameType         null.String       `json:"frame_type"`
+	Typeline          pq.StringArray    `json:"typeline"`
+	Ygoprodeck_url    null.String       `json:"ygoprodeck_url"`
+	Konami_id         null.Int          `json:"konami_id"`
+	Tcg_date          null.String       `json:"tcg_date"`
+	Ocg_date          null.String       `json:"ocg_date"`
+	Has_effect        null.Bool         `json:"has_effect"`
+	Formats           pq.StringArray    `json:"formats"`
+	ImagesJSON        []byte            `json:"-"`
+	Images            []CardImageDB     `json:"card_images"`
+	Sets              []CardSetDB       `json:"card_sets,omitempty"`
+	BanlistInfoString null.String       `json:"banlist_info_string"`
+	BanlistInfo       map[string]string `json:"banlist_info"`
 }
 
 type CardDB struct {
-	ID          int            `json:"id"`
-	Card_Name   string         `json:"card_name"`
-	Card_Type   string         `json:"card_type"`
-	Description string         `json:"description"`
-	Archetype   string         `json:"archetype"`
-	Atk         null.Int       `json:"atk"`
-	Def         null.Int       `json:"def"`
-	Card_Level  null.Int       `json:"card_level"`
-	Race        null.String    `json:"race"`
-	Attr        null.String    `json:"attribute"`
-	Linkval     null.Int       `json:"linkval"`
-	Linkmarkers pq.StringArray `json:"linkmarkers"`
-	Card_Scale  null.Int       `json:"card_scale"`
-	Images      []CardImageDB  `json:"card_images"`
+	ID             int                 `json:"id"`
+	Card_Name      string              `json:"card_name"`
+	Card_Type      string              `json:"card_type"`
+	Description    string              `json:"description"`
+	Archetype      string              `json:"archetype"`
+	Atk            null.Int            `json:"atk"`
+	Def            null.Int            `json:"def"`
+	Card_Level     null.Int            `json:"card_level"`
+	Race           null.String         `json:"race"`
+	Attr           null.String         `json:"attribute"`
+	Linkval        null.Int            `json:"linkval"`
+	Linkmarkers    pq.StringArray      `json:"linkmarkers"`
+	Card_Scale     null.Int            `json:"card_scale"`
+	FrameType      null.String         `json:"frameType"`
+	Typeline       pq.StringArray      `json:"typeline"`
+	Ygoprodeck_url null.String         `json:"ygoprodeck_url"`
+	MiscInfo       []CardMiscInfoDB    `json:"misc_info"`
+	Images         []CardImageDB       `json:"card_images"`
+	Sets           []CardSetDB         `json:"card_sets"`
+	Prices         []map[string]string `json:"card_prices"`
+}
+
+type CardSetDB struct {
+	Set_name        string `json:"set_name"`
+	Set_code        string `json:"set_code"`
+	Set_rarity      string `json:"set_rarity"`
+	Set_rarity_code string `json:"set_rarity_code"`
+	Set_price       string `json:"set_price"`
+}
+
+type CardSet struct {
+	ID              int           `json:"id"`
+	Set_name        string        `json:"set_name"`
+	Set_code        string        `json:"set_code"`
+	Printings_count int           `json:"printings_count"`
+	Printings       []SetPrinting `json:"printings,omitempty"`
+}
+
+type PricePoint struct {
+	Price       string    `json:"price"`
+	Recorded_at time.Time `json:"recorded_at"`
+}
+
+type CardSearchResult struct {
+	Card
+	Rank    float64 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+type NameSuggestion struct {
+	ID         int     `json:"id"`
+	Card_Name  string  `json:"card_name"`
+	Similarity float64 `json:"similarity"`
+}
+
+type NameLookup struct {
+	Query       string           `json:"query"`
+	Exact       bool             `json:"exact"`
+	Match       *Card            `json:"match"`
+	Suggestions []NameSuggestion `json:"suggestions"`
+}
+
+// Completion is a card name or archetype suggested while typing. Cards
+// carry their id, archetypes how many cards they have.
+type Completion struct {
+	Value string `json:"value"`
+	Kind  string `json:"kind"`
+	ID    int    `json:"id,omitempty"`
+	Cards int    `json:"cards,omitempty"`
+}
+
+type CardPrices struct {
+	Card_id int                     `json:"card_id"`
+	Current map[string]PricePoint   `json:"current"`
+	History map[string][]PricePoint `json:"history"`
+}
+
+type SetPrinting struct {
+	Card_id         int         `json:"card_id"`
+	Card_name       string      `json:"card_name"`
+	Set_code        string      `json:"set_code"`
+	Set_rarity      string      `json:"set_rarity"`
+	Set_rarity_code string      `json:"set_rarity_code"`
+	Set_price       null.String `json:"set_price"`
+}
+
+type CardMiscInfoDB struct {
+	Konami_id  null.Int       `json:"konami_id"`
+	Tcg_date   null.String    `json:"tcg_date"`
+	Ocg_date   null.String    `json:"ocg_date"`
+	Has_effect null.Int       `json:"has_effect"`
+	Formats    pq.StringArray `json:"formats"`
 }
 
 type CardImageDB struct {
-	ID              int    `json:"id"`
-	Image_url       string `json:"image_url"`
-	Image_url_small string `json:"image_url_small"`
+	ID                int    `json:"id"`
+	Image_url         string `json:"image_url"`
+	Image_url_small   string `json:"image_url_small"`
+	Image_url_cropped string `json:"image_url_cropped"`
+}
+
+type BanlistFormat struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+type BanlistVersion struct {
+	ID             int    `json:"id"`
+	Format         string `json:"format"`
+	Name           string `json:"name"`
+	Effective_date string `json:"effective_date"`
+}
+
+type BanlistChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Card Card   `json:"card"`
+}
+
+// BanlistChanges groups the cards that changed between two banlists by the
+// status they ended up with.
+type BanlistChanges struct {
+	Forbidden    []BanlistChange `json:"forbidden"`
+	Limited      []BanlistChange `json:"limited"`
+	Semi_limited []BanlistChange `json:"semi_limited"`
+	Unlimited    []BanlistChange `json:"unlimited"`
+}
+
+type BanlistDiff struct {
+	From    BanlistVersion `json:"from"`
+	To      BanlistVersion `json:"to"`
+	Changes BanlistChanges `json:"changes"`
 }
 
 type BanlistJSON struct {
@@ -64,4 +185,50 @@ type BanlistJSON struct {
 	BanlistInfo map[string]string `json:"banlist_info"`
 }
 
+type SyncSummary struct {
+	Added     int `json:"added"`
+	Updated   int `json:"updated"`
+	Removed   int `json:"removed"`
+	Unchanged int `json:"unchanged"`
+}
+
+type ValidationIssue struct {
+	Index   int    `json:"index"`
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type ValidationReport struct {
+	Checked int               `json:"checked"`
+	Valid   int               `json:"valid"`
+	Invalid int               `json:"invalid"`
+	Issues  []ValidationIssue `json:"issues"`
+}
+
+type ImportResult struct {
+	Mode       string            `json:"mode"`
+	Validation ValidationReport  `json:"validation"`
+	Skipped    []ValidationIssue `json:"skipped,omitempty"`
+	Sync       *SyncSummary      `json:"sync,omitempty"`
+}
+
+var Attributes = []string{"DARK", "DIVINE", "EARTH", "FIRE", "LIGHT", "WATER", "WIND"}
+
+var MonsterRaces = []string{
+	"Aqua", "Beast", "Beast-Warrior", "Creator-God", "Cyberse", "Dinosaur", "Divine-Beast",
+	"Dragon", "Fairy", "Fiend", "Fish", "Illusion", "Insect", "Machine", "Plant", "Psychic",
+	"Pyro", "Reptile", "Rock", "Sea Serpent", "Spellcaster", "Thunder", "Warrior",
+	"Winged Beast", "Wyrm", "Zombie",
+}
+
+var SpellTrapRaces = []string{"Continuous", "Counter", "Equip", "Field", "Normal", "Quick-Play", "Ritual"}
+
+var PriceVendors = []string{"amazon", "cardmarket", "coolstuffinc", "ebay", "tcgplayer"}
+
+var BanlistStatuses = []string{"Forbidden", "Limited", "Semi-Limited", "Unlimited"}
+
 const PostgresDriver = "postgres"
+
+const SqliteDriver = "sqlite3"
@@ -0,0 +1,238 @@
+package dbjobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	StatePending    = "pending"
+	StateRunning    = "running"
+	StateDone       = "done"
+	StateFailed     = "failed"
+	maxJobErrors    = 1000
+	jobIdByteSize   = 8
+	jobRetention    = 24 * time.Hour
+	maxFinishedJobs = 100
+)
+
+type Job struct {
+	mu         sync.Mutex
+	id         string
+	kind       string
+	state      string
+	processed  int
+	total      int
+	errors     []string
+	result     interface{}
+	startedAt  *time.Time
+	finishedAt *time.Time
+}
+
+// JobStatus is a point-in-time copy of a Job, safe to serialise while the
+// job keeps running.
+type JobStatus struct {
+	ID         string      `json:"id"`
+	Kind       string      `json:"kind"`
+	State      string      `json:"state"`
+	Processed  int         `json:"processed"`
+	Total      int         `json:"total"`
+	Errors     []string    `json:"errors"`
+	Result     interface{} `json:"result"`
+	StartedAt  *time.Time  `json:"started_at"`
+	FinishedAt *time.Time  `json:"finished_at"`
+}
+
+var (
+	jobsMu sync.RWMutex
+	jobs   = map[string]*Job{}
+)
+
+// ErrJobRunning is returned by Start while a job of the same kind has not
+// finished yet.
+var ErrJobRunning = errors.New("a job of this kind is already running")
+
+// Start registers a job of the given kind and runs it in the background.
+// Whatever run returns becomes the job result, and an error marks it failed.
+// Jobs of one kind write to the same tables, so only one runs at a time.
+func Start(kind string, run func(job *Job) (interface{}, error)) (*Job, error) {
+	job := &Job{id: newJobId(), kind: kind, state: StatePending, errors: []string{}}
+
+	jobsMu.Lock()
+	for _, other := range jobs {
+		if other.kind == kind && other.finishedTime() == nil {
+			jobsMu.Unlock()
+			return nil, ErrJobRunning
+		}
+	}
+
+	pruneJobs(time.Now())
+	jobs[job.id] = job
+	jobsMu.Unlock()
+
+	go func() {
+		job.start()
+
+		result, err := run(job)
+
+		job.finish(result, err)
+	}()
+
+	return job, nil
+}
+
+// pruneJobs forgets finished jobs, and their results, once they are older
+// than jobRetention or beyond the newest maxFinishedJobs. Running jobs are
+// always kept. jobsMu must be held.
+func pruneJobs(now time.Time) {
+	finished := []*Job{}
+	for id, job := range jobs {
+		finishedAt := job.finishedTime()
+		if finishedAt == nil {
+			continue
+		}
+
+		if now.Sub(*finishedAt) > jobRetention {
+			delete(jobs, id)
+			continue
+		}
+
+		finished = append(finished, job)
+	}
+
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].finishedTime().After(*finished[j].finishedTime())
+	})
+
+	for _, job := range finished[maxFinishedJobs:] {
+		delete(jobs, job.id)
+	}
+}
+
+func (job *Job) finishedTime() *time.Time {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	return job.finishedAt
+}
+
+func Get(id string) (JobStatus, bool) {
+	jobsMu.RLock()
+	job, ok := jobs[id]
+	jobsMu.RUnlock()
+
+	if !ok {
+		return JobStatus{}, false
+	}
+
+	return job.Status(), true
+}
+
+// List returns every job, newest first. Jobs that have not started yet come
+// before all others.
+func List() []JobStatus {
+	jobsMu.RLock()
+	defer jobsMu.RUnlock()
+
+	statuses := []JobStatus{}
+	for _, job := range jobs {
+		statuses = append(statuses, job.Status())
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		a, b := statuses[i].StartedAt, statuses[j].StartedAt
+		if a == nil || b == nil {
+			return a == nil && b != nil
+		}
+
+		return a.After(*b)
+	})
+
+	return statuses
+}
+
+func (job *Job) Status() JobStatus {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	errors := make([]string, len(job.errors))
+	copy(errors, job.errors)
+
+	return JobStatus{
+		ID:         job.id,
+		Kind:       job.kind,
+		State:      job.state,
+		Processed:  job.processed,
+		Total:      job.total,
+		Errors:     errors,
+		Result:     job.result,
+		StartedAt:  job.startedAt,
+		FinishedAt: job.finishedAt,
+	}
+}
+
+func (job *Job) SetTotal(total int) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	job.total = total
+}
+
+func (job *Job) Add(processed int) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	job.processed += processed
+}
+
+func (job *Job) AddError(err error) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	if len(job.errors) < maxJobErrors {
+		job.errors = append(job.errors, err.Error())
+	}
+}
+
+func (job *Job) start() {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	now := time.Now()
+	job.state = StateRunning
+	job.startedAt = &now
+}
+
+func (job *Job) finish(result interface{}, err error) {
+	if err != nil {
+		job.AddError(err)
+	}
+
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	now := time.Now()
+	job.result = result
+	job.finishedAt = &now
+
+	if err != nil {
+		job.state = StateFailed
+	} else {
+		job.state = StateDone
+	}
+}
+
+func newJobId() string {
+	bytes := make([]byte, jobIdByteSize)
+	rand.Read(bytes)
+
+	return hex.EncodeToString(bytes)
+}
@@ -0,0 +1,140 @@
+package dbjobs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// finishedJob makes a job that finished at the given time, without running it.
+func finishedJob(id string, finishedAt time.Time) *Job {
+	return &Job{id: id, kind: "cards", state: StateDone, startedAt: &finishedAt, finishedAt: &finishedAt}
+}
+
+func resetJobs(t *testing.T) {
+	jobsMu.Lock()
+	jobs = map[string]*Job{}
+	jobsMu.Unlock()
+
+	t.Cleanup(func() {
+		jobsMu.Lock()
+		jobs = map[string]*Job{}
+		jobsMu.Unlock()
+	})
+}
+
+func TestPruneJobsDropsExpiredJobs(t *testing.T) {
+	resetJobs(t)
+	now := time.Now()
+
+	jobs["old"] = finishedJob("old", now.Add(-jobRetention-time.Minute))
+	jobs["recent"] = finishedJob("recent", now.Add(-time.Hour))
+	jobs["running"] = &Job{id: "running", kind: "cards", state: StateRunning, startedAt: &now}
+
+	pruneJobs(now)
+
+	if _, ok := jobs["old"]; ok {
+		t.Errorf("a job finished over %s ago was kept", jobRetention)
+	}
+
+	for _, id := range []string{"recent", "running"} {
+		if _, ok := jobs[id]; !ok {
+			t.Errorf("job %q was dropped", id)
+		}
+	}
+}
+
+func TestPruneJobsKeepsTheNewestFinishedJobs(t *testing.T) {
+	resetJobs(t)
+	now := time.Now()
+
+	for i := 0; i < maxFinishedJobs+10; i++ {
+		id := fmt.Sprint(i)
+		jobs[id] = finishedJob(id, now.Add(-time.Duration(i)*time.Minute))
+	}
+	jobs["running"] = &Job{id: "running", kind: "cards", state: StateRunning, startedAt: &now}
+
+	pruneJobs(now)
+
+	if len(jobs) != maxFinishedJobs+1 {
+		t.Errorf("%d jobs kept, want %d finished and the running one", len(jobs), maxFinishedJobs)
+	}
+
+	for i := 0; i < maxFinishedJobs+10; i++ {
+		_, ok := jobs[fmt.Sprint(i)]
+		if ok != (i < maxFinishedJobs) {
+			t.Errorf("job %d kept = %t, want %t", i, ok, i < maxFinishedJobs)
+		}
+	}
+
+	if _, ok := jobs["running"]; !ok {
+		t.Errorf("the running job was dropped")
+	}
+}
+
+func TestAddErrorStopsAtTheLimit(t *testing.T) {
+	job := &Job{errors: []string{}}
+
+	for i := 0; i < maxJobErrors+5; i++ {
+		job.AddError(fmt.Errorf("error %d", i))
+	}
+
+	status := job.Status()
+	if len(status.Errors) != maxJobErrors {
+		t.Fatalf("%d errors kept, want %d", len(status.Errors), maxJobErrors)
+	}
+
+	if status.Errors[maxJobErrors-1] != fmt.Sprintf("error %d", maxJobErrors-1) {
+		t.Errorf("last error = %q, want the first %d to be kept", status.Errors[maxJobErrors-1], maxJobErrors)
+	}
+}
+
+func TestStartRefusesASecondJobOfTheSameKind(t *testing.T) {
+	resetJobs(t)
+
+	release := make(chan struct{})
+	first, err := Start("cards", func(job *Job) (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := Start("cards", func(job *Job) (interface{}, error) { return nil, nil }); !errors.Is(err, ErrJobRunning) {
+		t.Errorf("second job error = %v, want ErrJobRunning", err)
+	}
+
+	if _, err := Start("banlist_tcg", func(job *Job) (interface{}, error) { return nil, nil }); err != nil {
+		t.Errorf("job of another kind: unexpected error: %s", err)
+	}
+
+	close(release)
+	for first.finishedTime() == nil {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := Start("cards", func(job *Job) (interface{}, error) { return nil, nil }); err != nil {
+		t.Errorf("job after the first finished: unexpected error: %s", err)
+	}
+}
+
+func TestListIsNewestFirst(t *testing.T) {
+	resetJobs(t)
+	now := time.Now()
+
+	jobs["a"] = finishedJob("a", now.Add(-2*time.Hour))
+	jobs["b"] = finishedJob("b", now)
+	jobs["c"] = finishedJob("c", now.Add(-time.Hour))
+	jobs["pending"] = &Job{id: "pending", kind: "cards", state: StatePending}
+
+	ids := []string{}
+	for _, status := range List() {
+		ids = append(ids, status.ID)
+	}
+
+	if fmt.Sprint(ids) != "[pending b c a]" {
+		t.Errorf("List() = %v, want [pending b c a]", ids)
+	}
+}
@@ -0,0 +1,564 @@
+package dbmigrate
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+const versionTable = "schema_version"
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      func() string
+	Down    func() string
+}
+
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+// Table names are read from the environment when a migration runs, so every
+// statement is built lazily instead of at package init.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create card, image and banlist tables",
+		Up: func() string {
+			return fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %[1]s (
+				id integer PRIMARY KEY,
+				card_name text NOT NULL,
+				card_type text NOT NULL,
+				description text NOT NULL DEFAULT '',
+				archetype text NOT NULL DEFAULT '',
+				atk integer CHECK (atk IS NULL OR atk >= 0),
+				def integer CHECK (def IS NULL OR def >= 0),
+				card_level integer CHECK (card_level IS NULL OR card_level >= 0),
+				race text,
+				attr text,
+				linkval integer CHECK (linkval IS NULL OR linkval >= 0),
+				linkmarkers text[],
+				card_scale integer CHECK (card_scale IS NULL OR card_scale >= 0)
+			);
+			CREATE INDEX IF NOT EXISTS %[1]s_card_name_idx ON %[1]s (card_name);
+			CREATE INDEX IF NOT EXISTS %[1]s_archetype_idx ON %[1]s (archetype);
+
+			CREATE TABLE IF NOT EXISTS %[2]s (
+				id integer PRIMARY KEY,
+				card_id integer NOT NULL REFERENCES %[1]s (id) ON DELETE CASCADE,
+				image_url text NOT NULL,
+				image_url_small text NOT NULL
+			);
+			CREATE INDEX IF NOT EXISTS %[2]s_card_id_idx ON %[2]s (card_id);
+
+			CREATE TABLE IF NOT EXISTS %[3]s (
+				id integer PRIMARY KEY,
+				card_id integer NOT NULL REFERENCES %[1]s (id) ON DELETE CASCADE,
+				banlist_info jsonb NOT NULL,
+				frameType text
+			);
+			CREATE INDEX IF NOT EXISTS %[3]s_card_id_idx ON %[3]s (card_id);
+
+			CREATE TABLE IF NOT EXISTS %[4]s (
+				id integer PRIMARY KEY,
+				card_id integer NOT NULL REFERENCES %[1]s (id) ON DELETE CASCADE,
+				banlist_info jsonb NOT NULL,
+				frameType text
+			);
+			CREATE INDEX IF NOT EXISTS %[4]s_card_id_idx ON %[4]s (card_id);
+			`, os.Getenv("CARD_TABLE_NAME"), os.Getenv("IMAGES_TABLE_NAME"),
+				legacyTable("BANLIST_TABLE_NAME", "banlist"), legacyTable("OCG_BANLIST_TABLE_NAME", "banlist_ocg"))
+		},
+		Down: func() string {
+			return fmt.Sprintf(`
+			DROP TABLE IF EXISTS %s;
+			DROP TABLE IF EXISTS %s;
+			DROP TABLE IF EXISTS %s;
+			DROP TABLE IF EXISTS %s;
+			`, legacyTable("OCG_BANLIST_TABLE_NAME", "banlist_ocg"), legacyTable("BANLIST_TABLE_NAME", "banlist"),
+				os.Getenv("IMAGES_TABLE_NAME"), os.Getenv("CARD_TABLE_NAME"))
+		},
+	},
+	{
+		Version: 2,
+		Name:    "add cropped artwork to card images",
+		Up: func() string {
+			return fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS image_url_cropped text`,
+				os.Getenv("IMAGES_TABLE_NAME"))
+		},
+		Down: func() string {
+			return fmt.Sprintf(`ALTER TABLE %s DROP COLUMN IF EXISTS image_url_cropped`,
+				os.Getenv("IMAGES_TABLE_NAME"))
+		},
+	},
+	{
+		Version: 3,
+		Name:    "add YGOPRODeck metadata to cards",
+		Up: func() string {
+			return fmt.Sprintf(`
+			ALTER TABLE %[1]s
+				ADD COLUMN IF NOT EXISTS frame_type text,
+				ADD COLUMN IF NOT EXISTS typeline text[],
+				ADD COLUMN IF NOT EXISTS ygoprodeck_url text,
+				ADD COLUMN IF NOT EXISTS konami_id integer,
+				ADD COLUMN IF NOT EXISTS tcg_date date,
+				ADD COLUMN IF NOT EXISTS ocg_date date,
+				ADD COLUMN IF NOT EXISTS has_effect boolean,
+				ADD COLUMN IF NOT EXISTS formats text[];
+			CREATE INDEX IF NOT EXISTS %[1]s_konami_id_idx ON %[1]s (konami_id);
+			CREATE INDEX IF NOT EXISTS %[1]s_formats_idx ON %[1]s USING gin (formats);
+			`, os.Getenv("CARD_TABLE_NAME"))
+		},
+		Down: func() string {
+			return fmt.Sprintf(`
+			ALTER TABLE %s
+				DROP COLUMN IF EXISTS frame_type,
+				DROP COLUMN IF EXISTS typeline,
+				DROP COLUMN IF EXISTS ygoprodeck_url,
+				DROP COLUMN IF EXISTS konami_id,
+				DROP COLUMN IF EXISTS tcg_date,
+				DROP COLUMN IF EXISTS ocg_date,
+				DROP COLUMN IF EXISTS has_effect,
+				DROP COLUMN IF EXISTS formats;
+			`, os.Getenv("CARD_TABLE_NAME"))
+		},
+	},
+	{
+		Version: 4,
+		Name:    "create card sets and set printings",
+		Up: func() string {
+			return fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %[2]s (
+				id serial PRIMARY KEY,
+				set_name text NOT NULL UNIQUE,
+				set_code text NOT NULL
+			);
+			CREATE INDEX IF NOT EXISTS %[2]s_set_code_idx ON %[2]s (set_code);
+
+			CREATE TABLE IF NOT EXISTS %[3]s (
+				card_id integer NOT NULL REFERENCES %[1]s (id) ON DELETE CASCADE,
+				set_id integer NOT NULL REFERENCES %[2]s (id) ON DELETE CASCADE,
+				set_code text NOT NULL,
+				set_rarity text NOT NULL,
+				set_rarity_code text NOT NULL DEFAULT '',
+				set_price numeric(12, 2) CHECK (set_price IS NULL OR set_price >= 0),
+				PRIMARY KEY (card_id, set_code, set_rarity)
+			);
+			CREATE INDEX IF NOT EXISTS %[3]s_set_id_idx ON %[3]s (set_id);
+			CREATE INDEX IF NOT EXISTS %[3]s_set_code_idx ON %[3]s (set_code text_pattern_ops);
+			`, os.Getenv("CARD_TABLE_NAME"), os.Getenv("SETS_TABLE_NAME"), os.Getenv("SET_PRINTINGS_TABLE_NAME"))
+		},
+		Down: func() string {
+			return fmt.Sprintf(`
+			DROP TABLE IF EXISTS %s;
+			DROP TABLE IF EXISTS %s;
+			`, os.Getenv("SET_PRINTINGS_TABLE_NAME"), os.Getenv("SETS_TABLE_NAME"))
+		},
+	},
+	{
+		Version: 5,
+		Name:    "create card price history",
+		Up: func() string {
+			return fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %[2]s (
+				card_id integer NOT NULL REFERENCES %[1]s (id) ON DELETE CASCADE,
+				vendor text NOT NULL,
+				price numeric(12, 2) NOT NULL CHECK (price >= 0),
+				recorded_at timestamptz NOT NULL DEFAULT now(),
+				PRIMARY KEY (card_id, vendor, recorded_at)
+			);
+			CREATE INDEX IF NOT EXISTS %[2]s_vendor_idx ON %[2]s (vendor, card_id, recorded_at DESC);
+			`, os.Getenv("CARD_TABLE_NAME"), os.Getenv("PRICES_TABLE_NAME"))
+		},
+		Down: func() string {
+			return fmt.Sprintf(`DROP TABLE IF EXISTS %s`, os.Getenv("PRICES_TABLE_NAME"))
+		},
+	},
+	{
+		Version: 6,
+		Name:    "add dated banlist versions",
+		Up: func() string {
+			return fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %[1]s (
+				id serial PRIMARY KEY,
+				mode text NOT NULL,
+				name text NOT NULL UNIQUE,
+				effective_date date NOT NULL,
+				created_at timestamptz NOT NULL DEFAULT now(),
+				UNIQUE (mode, effective_date)
+			);
+
+			-- Rows loaded before versioning become the list in force from today
+			INSERT INTO %[1]s (mode, name, effective_date)
+			SELECT 'tcg', 'TCG ' || current_date, current_date WHERE EXISTS (SELECT 1 FROM %[2]s);
+			INSERT INTO %[1]s (mode, name, effective_date)
+			SELECT 'ocg', 'OCG ' || current_date, current_date WHERE EXISTS (SELECT 1 FROM %[3]s);
+
+			ALTER TABLE %[2]s ADD COLUMN version_id integer REFERENCES %[1]s (id) ON DELETE CASCADE;
+			UPDATE %[2]s SET version_id = (SELECT id FROM %[1]s WHERE mode = 'tcg');
+			ALTER TABLE %[2]s ALTER COLUMN version_id SET NOT NULL;
+			ALTER TABLE %[2]s DROP CONSTRAINT IF EXISTS %[2]s_pkey;
+			ALTER TABLE %[2]s ADD PRIMARY KEY (version_id, card_id);
+
+			ALTER TABLE %[3]s ADD COLUMN version_id integer REFERENCES %[1]s (id) ON DELETE CASCADE;
+			UPDATE %[3]s SET version_id = (SELECT id FROM %[1]s WHERE mode = 'ocg');
+			ALTER TABLE %[3]s ALTER COLUMN version_id SET NOT NULL;
+			ALTER TABLE %[3]s DROP CONSTRAINT IF EXISTS %[3]s_pkey;
+			ALTER TABLE %[3]s ADD PRIMARY KEY (version_id, card_id);
+			`, os.Getenv("BANLIST_VERSIONS_TABLE_NAME"), legacyTable("BANLIST_TABLE_NAME", "banlist"),
+				legacyTable("OCG_BANLIST_TABLE_NAME", "banlist_ocg"))
+		},
+		Down: func() string {
+			return fmt.Sprintf(`
+			-- Only the newest version of each mode survives the rollback
+			DELETE FROM %[2]s WHERE version_id <> (SELECT id FROM %[1]s WHERE mode = 'tcg' ORDER BY effective_date DESC LIMIT 1);
+			ALTER TABLE %[2]s DROP CONSTRAINT IF EXISTS %[2]s_pkey;
+			ALTER TABLE %[2]s DROP COLUMN IF EXISTS version_id;
+			ALTER TABLE %[2]s ADD PRIMARY KEY (id);
+
+			DELETE FROM %[3]s WHERE version_id <> (SELECT id FROM %[1]s WHERE mode = 'ocg' ORDER BY effective_date DESC LIMIT 1);
+			ALTER TABLE %[3]s DROP CONSTRAINT IF EXISTS %[3]s_pkey;
+			ALTER TABLE %[3]s DROP COLUMN IF EXISTS version_id;
+			ALTER TABLE %[3]s ADD PRIMARY KEY (id);
+
+			DROP TABLE IF EXISTS %[1]s;
+			`, os.Getenv("BANLIST_VERSIONS_TABLE_NAME"), legacyTable("BANLIST_TABLE_NAME", "banlist"),
+				legacyTable("OCG_BANLIST_TABLE_NAME", "banlist_ocg"))
+		},
+	},
+	{
+		Version: 7,
+		Name:    "replace per-mode banlist tables with format-keyed entries",
+		Up: func() string {
+			return fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %[1]s (
+				code text PRIMARY KEY CHECK (code ~ '^[a-z0-9_]+$'),
+				name text NOT NULL,
+				created_at timestamptz NOT NULL DEFAULT now()
+			);
+			INSERT INTO %[1]s (code, name) VALUES
+				('tcg', 'TCG'), ('ocg', 'OCG'), ('goat', 'GOAT'), ('speed', 'Speed Duel')
+			ON CONFLICT (code) DO NOTHING;
+
+			ALTER TABLE %[2]s RENAME COLUMN mode TO format;
+			ALTER TABLE %[2]s ADD CONSTRAINT %[2]s_format_fkey
+				FOREIGN KEY (format) REFERENCES %[1]s (code) ON DELETE CASCADE;
+
+			CREATE TABLE IF NOT EXISTS %[3]s (
+				version_id integer NOT NULL REFERENCES %[2]s (id) ON DELETE CASCADE,
+				card_id integer NOT NULL REFERENCES %[4]s (id) ON DELETE CASCADE,
+				status text NOT NULL CHECK (status IN ('Forbidden', 'Limited', 'Semi-Limited', 'Unlimited')),
+				PRIMARY KEY (version_id, card_id)
+			);
+			CREATE INDEX IF NOT EXISTS %[3]s_card_id_idx ON %[3]s (card_id);
+
+			INSERT INTO %[3]s (version_id, card_id, status)
+			SELECT version_id, card_id, banlist_info->>'ban_tcg' FROM %[5]s
+			WHERE banlist_info->>'ban_tcg' IN ('Forbidden', 'Limited', 'Semi-Limited', 'Unlimited')
+			ON CONFLICT DO NOTHING;
+			INSERT INTO %[3]s (version_id, card_id, status)
+			SELECT version_id, card_id, banlist_info->>'ban_ocg' FROM %[6]s
+			WHERE banlist_info->>'ban_ocg' IN ('Forbidden', 'Limited', 'Semi-Limited', 'Unlimited')
+			ON CONFLICT DO NOTHING;
+
+			DROP TABLE IF EXISTS %[5]s;
+			DROP TABLE IF EXISTS %[6]s;
+			`, os.Getenv("BANLIST_FORMATS_TABLE_NAME"), os.Getenv("BANLIST_VERSIONS_TABLE_NAME"),
+				os.Getenv("BANLIST_ENTRIES_TABLE_NAME"), os.Getenv("CARD_TABLE_NAME"),
+				legacyTable("BANLIST_TABLE_NAME", "banlist"), legacyTable("OCG_BANLIST_TABLE_NAME", "banlist_ocg"))
+		},
+		Down: func() string {
+			return fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %[5]s (
+				id integer NOT NULL,
+				card_id integer NOT NULL REFERENCES %[4]s (id) ON DELETE CASCADE,
+				banlist_info jsonb NOT NULL,
+				frameType text,
+				version_id integer NOT NULL REFERENCES %[2]s (id) ON DELETE CASCADE,
+				PRIMARY KEY (version_id, card_id)
+			);
+			CREATE INDEX IF NOT EXISTS %[5]s_card_id_idx ON %[5]s (card_id);
+
+			CREATE TABLE IF NOT EXISTS %[6]s (
+				id integer NOT NULL,
+				card_id integer NOT NULL REFERENCES %[4]s (id) ON DELETE CASCADE,
+				banlist_info jsonb NOT NULL,
+				frameType text,
+				version_id integer NOT NULL REFERENCES %[2]s (id) ON DELETE CASCADE,
+				PRIMARY KEY (version_id, card_id)
+			);
+			CREATE INDEX IF NOT EXISTS %[6]s_card_id_idx ON %[6]s (card_id);
+
+			INSERT INTO %[5]s (id, card_id, banlist_info, version_id)
+			SELECT e.card_id, e.card_id, jsonb_build_object('ban_tcg', e.status), e.version_id
+			FROM %[3]s e JOIN %[2]s v ON v.id = e.version_id
+			WHERE v.format = 'tcg';
+			INSERT INTO %[6]s (id, card_id, banlist_info, version_id)
+			SELECT e.card_id, e.card_id, jsonb_build_object('ban_ocg', e.status), e.version_id
+			FROM %[3]s e JOIN %[2]s v ON v.id = e.version_id
+			WHERE v.format = 'ocg';
+
+			DROP TABLE IF EXISTS %[3]s;
+			DELETE FROM %[2]s WHERE format NOT IN ('tcg', 'ocg');
+			ALTER TABLE %[2]s DROP CONSTRAINT IF EXISTS %[2]s_format_fkey;
+			ALTER TABLE %[2]s RENAME COLUMN format TO mode;
+			DROP TABLE IF EXISTS %[1]s;
+			`, os.Getenv("BANLIST_FORMATS_TABLE_NAME"), os.Getenv("BANLIST_VERSIONS_TABLE_NAME"),
+				os.Getenv("BANLIST_ENTRIES_TABLE_NAME"), os.Getenv("CARD_TABLE_NAME"),
+				legacyTable("BANLIST_TABLE_NAME", "banlist"), legacyTable("OCG_BANLIST_TABLE_NAME", "banlist_ocg"))
+		},
+	},
+	{
+		Version: 8,
+		Name:    "add full-text search vector to cards",
+		Up: func() string {
+			return fmt.Sprintf(`
+			ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS search_vector tsvector
+				GENERATED ALWAYS AS (
+					setweight(to_tsvector('english', coalesce(card_name, '')), 'A') ||
+					setweight(to_tsvector('english', coalesce(description, '')), 'B')
+				) STORED;
+			CREATE INDEX IF NOT EXISTS %[1]s_search_vector_idx ON %[1]s USING gin (search_vector);
+			`, os.Getenv("CARD_TABLE_NAME"))
+		},
+		Down: func() string {
+			return fmt.Sprintf(`
+			ALTER TABLE %s DROP COLUMN IF EXISTS search_vector;
+			`, os.Getenv("CARD_TABLE_NAME"))
+		},
+	},
+	{
+		Version: 9,
+		Name:    "add normalized card names for fuzzy lookup",
+		Up: func() string {
+			return fmt.Sprintf(`
+			CREATE EXTENSION IF NOT EXISTS pg_trgm;
+			CREATE EXTENSION IF NOT EXISTS unaccent;
+
+			-- unaccent() is only STABLE, so generated columns need this wrapper
+			-- naming its dictionary: lowercase, no diacritics, and any run of
+			-- hyphens, punctuation or spaces turned into one space
+			CREATE OR REPLACE FUNCTION card_name_normalize(name text) RETURNS text
+			LANGUAGE sql IMMUTABLE PARALLEL SAFE AS $$
+				SELECT trim(regexp_replace(
+					lower(public.unaccent('public.unaccent'::regdictionary, name)),
+					'[^[:alnum:]]+', ' ', 'g'
+				))
+			$$;
+
+			ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS name_normalized text
+				GENERATED ALWAYS AS (card_name_normalize(card_name)) STORED;
+			CREATE INDEX IF NOT EXISTS %[1]s_name_normalized_idx ON %[1]s USING gin (name_normalized gin_trgm_ops);
+			`, os.Getenv("CARD_TABLE_NAME"))
+		},
+		Down: func() string {
+			// The extensions stay, other database objects may rely on them
+			return fmt.Sprintf(`
+			ALTER TABLE %s DROP COLUMN IF EXISTS name_normalized;
+			DROP FUNCTION IF EXISTS card_name_normalize(text);
+			`, os.Getenv("CARD_TABLE_NAME"))
+		},
+	},
+}
+
+// tableVariables name the tables the migrations create. An unset one would
+// turn into DDL like "CREATE TABLE  (", so they are checked before running.
+var tableVariables = []string{
+	"CARD_TABLE_NAME", "IMAGES_TABLE_NAME", "SETS_TABLE_NAME", "SET_PRINTINGS_TABLE_NAME",
+	"PRICES_TABLE_NAME", "BANLIST_FORMATS_TABLE_NAME", "BANLIST_VERSIONS_TABLE_NAME",
+	"BANLIST_ENTRIES_TABLE_NAME",
+}
+
+// checkTableVariables fails on the first table name missing from the
+// environment.
+func checkTableVariables() error {
+	for _, key := range tableVariables {
+		if os.Getenv(key) == "" {
+			return fmt.Errorf("%s is not set; it names a table the migrations create", key)
+		}
+	}
+
+	return nil
+}
+
+// legacyTable names a table that only early migrations know about. Its
+// variable may be gone from the environment, so the old default is used.
+func legacyTable(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	return fallback
+}
+
+// Migrate applies every pending migration in order, each one in its own
+// transaction, and returns the resulting schema version.
+func Migrate(DB *sql.DB) (int, error) {
+	if err := checkTableVariables(); checkErr(err) {
+		return 0, err
+	}
+
+	current, err := CurrentVersion(DB)
+	if checkErr(err) {
+		return 0, err
+	}
+
+	for _, migration := range migrations {
+		if migration.Version <= current {
+			continue
+		}
+
+		err = runMigration(DB, migration, "up")
+		if checkErr(err) {
+			return current, err
+		}
+
+		fmt.Printf("Applied migration %d: %s \n", migration.Version, migration.Name)
+		current = migration.Version
+	}
+
+	return current, nil
+}
+
+// Rollback reverts the most recently applied migration and returns the
+// resulting schema version.
+func Rollback(DB *sql.DB) (int, error) {
+	if err := checkTableVariables(); checkErr(err) {
+		return 0, err
+	}
+
+	current, err := CurrentVersion(DB)
+	if checkErr(err) {
+		return 0, err
+	}
+
+	if current == 0 {
+		return 0, fmt.Errorf("no migration to roll back")
+	}
+
+	previous := 0
+	for _, migration := range migrations {
+		if migration.Version == current {
+			err = runMigration(DB, migration, "down")
+			if checkErr(err) {
+				return current, err
+			}
+
+			fmt.Printf("Rolled back migration %d: %s \n", migration.Version, migration.Name)
+			return previous, nil
+		}
+
+		previous = migration.Version
+	}
+
+	return current, fmt.Errorf("unknown schema version %d", current)
+}
+
+func CurrentVersion(DB *sql.DB) (int, error) {
+	err := ensureVersionTable(DB)
+	if checkErr(err) {
+		return 0, err
+	}
+
+	var version int
+	sqlStatement := fmt.Sprintf(`SELECT COALESCE(MAX(version), 0) FROM %s`, versionTable)
+	err = DB.QueryRow(sqlStatement).Scan(&version)
+
+	return version, err
+}
+
+func Status(DB *sql.DB) ([]MigrationStatus, error) {
+	err := ensureVersionTable(DB)
+	if checkErr(err) {
+		return []MigrationStatus{}, err
+	}
+
+	sqlStatement := fmt.Sprintf(`SELECT version, applied_at FROM %s`, versionTable)
+	query, err := DB.Query(sqlStatement)
+	if checkErr(err) {
+		return []MigrationStatus{}, err
+	}
+	defer query.Close()
+
+	applied := map[int]time.Time{}
+	for query.Next() {
+		var version int
+		var appliedAt time.Time
+
+		err = query.Scan(&version, &appliedAt)
+		if checkErr(err) {
+			return []MigrationStatus{}, err
+		}
+
+		applied[version] = appliedAt
+	}
+
+	statuses := []MigrationStatus{}
+	for _, migration := range migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+
+		if appliedAt, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = &appliedAt
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses, query.Err()
+}
+
+func ensureVersionTable(DB *sql.DB) error {
+	sqlStatement := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			version integer PRIMARY KEY,
+			name text NOT NULL,
+			applied_at timestamptz NOT NULL DEFAULT now()
+		)`, versionTable)
+
+	_, err := DB.Exec(sqlStatement)
+	return err
+}
+
+func runMigration(DB *sql.DB, migration Migration, direction string) error {
+	tx, err := DB.Begin()
+	if checkErr(err) {
+		return err
+	}
+	defer tx.Rollback()
+
+	if direction == "up" {
+		_, err = tx.Exec(migration.Up())
+		if checkErr(err) {
+			return fmt.Errorf("migration %d: %w", migration.Version, err)
+		}
+
+		_, err = tx.Exec(fmt.Sprintf(`INSERT INTO %s (version, name) VALUES ($1, $2)`, versionTable),
+			migration.Version, migration.Name)
+	} else {
+		_, err = tx.Exec(migration.Down())
+		if checkErr(err) {
+			return fmt.Errorf("rollback %d: %w", migration.Version, err)
+		}
+
+		_, err = tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE version = $1`, versionTable), migration.Version)
+	}
+
+	if checkErr(err) {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func checkErr(err error) bool {
+	return err != nil
+}
@@ -0,0 +1,61 @@
+package dbmigrate
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func setTableVariables(t *testing.T) {
+	for _, key := range tableVariables {
+		t.Setenv(key, strings.ToLower(strings.TrimSuffix(key, "_TABLE_NAME")))
+	}
+}
+
+// Both checks fail before the database is reached, so no connection is needed.
+func TestMissingTableVariableStopsMigrations(t *testing.T) {
+	for _, missing := range tableVariables {
+		t.Run(missing, func(t *testing.T) {
+			setTableVariables(t)
+			t.Setenv(missing, "")
+
+			if _, err := Migrate(nil); err == nil || !strings.Contains(err.Error(), missing) {
+				t.Errorf("Migrate error = %v, want one naming %s", err, missing)
+			}
+
+			if _, err := Rollback(nil); err == nil || !strings.Contains(err.Error(), missing) {
+				t.Errorf("Rollback error = %v, want one naming %s", err, missing)
+			}
+		})
+	}
+}
+
+// A table name read from a variable outside tableVariables would leave a
+// gap in the DDL where the name belongs.
+var missingTableName = regexp.MustCompile(
+	`\b(TABLE|ON|REFERENCES|FROM|INTO)\s+(\(|ADD|DROP|ALTER|SET|WHERE|USING|;)|IF (NOT )?EXISTS\s+(\(|ON|;)|\s_\w+_(idx|key)\b`)
+
+func TestMigrationsOnlyUseCheckedTableVariables(t *testing.T) {
+	setTableVariables(t)
+
+	for _, migration := range migrations {
+		for direction, statement := range map[string]string{"up": migration.Up(), "down": migration.Down()} {
+			if gap := missingTableName.FindString(statement); gap != "" {
+				t.Errorf("migration %d %s has no table name at %q", migration.Version, direction, gap)
+			}
+		}
+	}
+}
+
+func TestMissingTableNameIsCaught(t *testing.T) {
+	for _, statement := range []string{
+		"CREATE TABLE IF NOT EXISTS  (id integer)",
+		"CREATE INDEX IF NOT EXISTS _card_id_idx ON  (card_id)",
+		"ALTER TABLE  ADD COLUMN x text",
+		"card_id integer REFERENCES  (id)",
+	} {
+		if !missingTableName.MatchString(statement) {
+			t.Errorf("%q was not caught", statement)
+		}
+	}
+}
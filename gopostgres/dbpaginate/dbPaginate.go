@@ -3,13 +3,13 @@ package dbpaginate
 import (
 	"fmt"
 
-	dbConfig "Yu-Go-Oh-API/gopostgres/dbconfig"
-
 	_ "github.com/lib/pq"
 )
 
-func Paginate(query []dbConfig.Card, page int, qSize int, count int, url string) map[string]interface{} {
-	pages := count / qSize
+// Paginate wraps a page of results, cards or search results alike, with the
+// links to its neighbours.
+func Paginate(query interface{}, page int, qSize int, count int, url string) map[string]interface{} {
+	pages := (count + qSize - 1) / qSize
 
 	response := map[string]interface{}{
 		"cards":      query,
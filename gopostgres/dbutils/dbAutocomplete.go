@@ -0,0 +1,207 @@
+package dbutils
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	dbConfig "Yu-Go-Oh-API/gopostgres/dbconfig"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	completionCard      = "card"
+	completionArchetype = "archetype"
+)
+
+// completionKey is one way of reaching an entry: its whole normalised name,
+// or the name from one of its later words on, so "eyes" still completes
+// Blue-Eyes White Dragon.
+type completionKey struct {
+	key       string
+	wordStart bool
+	entry     *dbConfig.Completion
+}
+
+type completionIndex struct {
+	keys []completionKey
+}
+
+var (
+	completionsMu sync.RWMutex
+	completions   = &completionIndex{}
+)
+
+// letterFolds are the letters unaccent folds that have no decomposition
+// for NFKD to split the accent off.
+var letterFolds = map[rune]string{
+	'æ': "ae", 'œ': "oe", 'ø': "o", 'ł': "l", 'đ': "d", 'ð': "d", 'ħ': "h", 'ı': "i", 'ß': "ss", 'þ': "th",
+}
+
+// normalizeName folds name like card_name_normalize in the database: the
+// NFKD decomposition without its combining marks, so é is e and full-width
+// Ａ is A, lowercased, with every run of hyphens, punctuation and spaces
+// turned into one space.
+func normalizeName(name string) string {
+	var builder strings.Builder
+	space := false
+
+	for _, r := range norm.NFKD.String(name) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+
+		r = unicode.ToLower(r)
+		fold, ok := letterFolds[r]
+		if !ok {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				space = true
+				continue
+			}
+			fold = string(r)
+		}
+
+		if space && builder.Len() > 0 {
+			builder.WriteByte(' ')
+		}
+		builder.WriteString(fold)
+		space = false
+	}
+
+	return builder.String()
+}
+
+// BuildAutocompleteIndex reads every card name and archetype into the index
+// Autocomplete serves from. The previous index keeps answering until the new
+// one is complete.
+func BuildAutocompleteIndex(DB *sql.DB) error {
+	query, err := DB.Query(fmt.Sprintf(`SELECT id, card_name, coalesce(archetype, '') FROM %s`, os.Getenv("CARD_TABLE_NAME")))
+	if checkErr(err) {
+		return err
+	}
+	defer query.Close()
+
+	entries := []*dbConfig.Completion{}
+	archetypes := map[string]*dbConfig.Completion{}
+
+	for query.Next() {
+		var id int
+		var name, archetype string
+
+		err := query.Scan(&id, &name, &archetype)
+		if checkErr(err) {
+			return err
+		}
+
+		entries = append(entries, &dbConfig.Completion{Value: name, Kind: completionCard, ID: id})
+
+		if archetype == "" {
+			continue
+		}
+
+		if _, ok := archetypes[archetype]; !ok {
+			archetypes[archetype] = &dbConfig.Completion{Value: archetype, Kind: completionArchetype}
+			entries = append(entries, archetypes[archetype])
+		}
+		archetypes[archetype].Cards++
+	}
+
+	if checkErr(query.Err()) {
+		return query.Err()
+	}
+
+	index := newCompletionIndex(entries)
+
+	completionsMu.Lock()
+	completions = index
+	completionsMu.Unlock()
+
+	return nil
+}
+
+// newCompletionIndex keys every entry by its normalised name and by each of
+// its later words.
+func newCompletionIndex(entries []*dbConfig.Completion) *completionIndex {
+	index := &completionIndex{}
+	for _, entry := range entries {
+		key := normalizeName(entry.Value)
+
+		for i := 0; i < len(key); i++ {
+			if i == 0 || key[i-1] == ' ' {
+				index.keys = append(index.keys, completionKey{key: key[i:], wordStart: i > 0, entry: entry})
+			}
+		}
+	}
+
+	sort.Slice(index.keys, func(i, j int) bool {
+		return index.keys[i].key < index.keys[j].key
+	})
+
+	return index
+}
+
+// Autocomplete returns up to limit card names and archetypes starting with
+// text, or with one of their words starting with it. Names that start with
+// text rank first, then archetypes before cards and shorter names first.
+func Autocomplete(text string, limit int) []dbConfig.Completion {
+	prefix := normalizeName(text)
+	if prefix == "" {
+		return []dbConfig.Completion{}
+	}
+
+	completionsMu.RLock()
+	index := completions
+	completionsMu.RUnlock()
+
+	start := sort.Search(len(index.keys), func(i int) bool {
+		return index.keys[i].key >= prefix
+	})
+
+	// An entry reached through several of its words keeps its best match
+	matches := map[*dbConfig.Completion]bool{}
+	for i := start; i < len(index.keys) && strings.HasPrefix(index.keys[i].key, prefix); i++ {
+		key := index.keys[i]
+
+		if wordStart, ok := matches[key.entry]; !ok || wordStart {
+			matches[key.entry] = key.wordStart
+		}
+	}
+
+	ranked := make([]*dbConfig.Completion, 0, len(matches))
+	for entry := range matches {
+		ranked = append(ranked, entry)
+	}
+
+	sort.Slice(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+
+		switch {
+		case matches[a] != matches[b]:
+			return !matches[a]
+		case a.Kind != b.Kind:
+			return a.Kind == completionArchetype
+		case len(a.Value) != len(b.Value):
+			return len(a.Value) < len(b.Value)
+		case a.Value != b.Value:
+			return a.Value < b.Value
+		}
+
+		return a.ID < b.ID
+	})
+
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+
+	results := make([]dbConfig.Completion, len(ranked))
+	for i, entry := range ranked {
+		results[i] = *entry
+	}
+
+	return results
+}
@@ -0,0 +1,81 @@
+package dbutils
+
+import (
+	"reflect"
+	"testing"
+
+	dbConfig "Yu-Go-Oh-API/gopostgres/dbconfig"
+)
+
+func TestNormalizeName(t *testing.T) {
+	tests := map[string]string{
+		"Blue-Eyes White Dragon":     "blue eyes white dragon",
+		"  Dark  Magician  ":         "dark magician",
+		"Éclair, the Élite!":         "eclair the elite",
+		"Ｂｌｕｅ－Ｅｙｅｓ":                  "blue eyes",
+		"Mökey Mökey":                "mokey mokey",
+		"Ætherfrost Ødd ß":           "aetherfrost odd ss",
+		"Number 39: Utopia":          "number 39 utopia",
+		"Elemental HERO Neos (Alt.)": "elemental hero neos alt",
+		"---":                        "",
+	}
+
+	for name, want := range tests {
+		if got := normalizeName(name); got != want {
+			t.Errorf("normalizeName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestAutocomplete(t *testing.T) {
+	entries := []*dbConfig.Completion{
+		{Value: "Blue-Eyes White Dragon", Kind: completionCard, ID: 89631139},
+		{Value: "Blue-Eyes Alternative White Dragon", Kind: completionCard, ID: 38517737},
+		{Value: "Blue-Eyes", Kind: completionArchetype, Cards: 2},
+		{Value: "Dragon Spirit of White", Kind: completionCard, ID: 45467446},
+		{Value: "Dark Magician", Kind: completionCard, ID: 46986414},
+		{Value: "Éclair", Kind: completionCard, ID: 1},
+	}
+
+	completionsMu.Lock()
+	previous := completions
+	completions = newCompletionIndex(entries)
+	completionsMu.Unlock()
+
+	t.Cleanup(func() {
+		completionsMu.Lock()
+		completions = previous
+		completionsMu.Unlock()
+	})
+
+	tests := []struct {
+		text   string
+		limit  int
+		values []string
+	}{
+		// Archetypes before cards, then shorter names first
+		{"blue ey", 10, []string{"Blue-Eyes", "Blue-Eyes White Dragon", "Blue-Eyes Alternative White Dragon"}},
+		{"Blue-Eyes", 2, []string{"Blue-Eyes", "Blue-Eyes White Dragon"}},
+		// Names starting with the text come before names with a later word
+		// starting with it
+		{"dragon", 10, []string{"Dragon Spirit of White", "Blue-Eyes White Dragon", "Blue-Eyes Alternative White Dragon"}},
+		{"white", 10, []string{"Blue-Eyes White Dragon", "Dragon Spirit of White", "Blue-Eyes Alternative White Dragon"}},
+		{"ECLAIR", 10, []string{"Éclair"}},
+		{"ｄａｒｋ", 10, []string{"Dark Magician"}},
+		{"agician", 10, []string{}},
+		{"  ", 10, []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			values := []string{}
+			for _, completion := range Autocomplete(test.text, test.limit) {
+				values = append(values, completion.Value)
+			}
+
+			if !reflect.DeepEqual(values, test.values) {
+				t.Errorf("Autocomplete(%q) = %q, want %q", test.text, values, test.values)
+			}
+		})
+	}
+}
@@ -0,0 +1,439 @@
+package dbutils
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	dbConfig "Yu-Go-Oh-API/gopostgres/dbconfig"
+
+	pq "github.com/lib/pq"
+)
+
+const dateLayout = "2006-01-02"
+
+var formatCodePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// reservedFormatCodes are the /banlist/ routes a format code would be
+// shadowed by, so GET /banlist/:format could never serve it.
+var reservedFormatCodes = []string{"diff", "formats", "load"}
+
+var entryColumns = []string{"version_id", "card_id", "status"}
+
+func GetBanlistFormats(DB *sql.DB) ([]dbConfig.BanlistFormat, error) {
+	sqlStatement := fmt.Sprintf(`SELECT code, name FROM %s ORDER BY created_at, code`,
+		os.Getenv("BANLIST_FORMATS_TABLE_NAME"))
+
+	query, err := DB.Query(sqlStatement)
+	if checkErr(err) {
+		return []dbConfig.BanlistFormat{}, err
+	}
+	defer query.Close()
+
+	formats := []dbConfig.BanlistFormat{}
+	for query.Next() {
+		var format dbConfig.BanlistFormat
+
+		err = query.Scan(&format.Code, &format.Name)
+		if checkErr(err) {
+			return []dbConfig.BanlistFormat{}, err
+		}
+
+		formats = append(formats, format)
+	}
+
+	return formats, query.Err()
+}
+
+// GetBanlistFormat returns sql.ErrNoRows when code is not a registered format.
+func GetBanlistFormat(DB *sql.DB, code string) (dbConfig.BanlistFormat, error) {
+	var format dbConfig.BanlistFormat
+
+	sqlStatement := fmt.Sprintf(`SELECT code, name FROM %s WHERE code = $1`,
+		os.Getenv("BANLIST_FORMATS_TABLE_NAME"))
+
+	err := DB.QueryRow(sqlStatement, code).Scan(&format.Code, &format.Name)
+
+	return format, err
+}
+
+// FormatCodeError is a format code CreateBanlistFormat refuses.
+type FormatCodeError struct {
+	Code   string
+	Reason string
+}
+
+func (err *FormatCodeError) Error() string {
+	return fmt.Sprintf("invalid format code %q, %s", err.Code, err.Reason)
+}
+
+// CreateBanlistFormat registers a custom format. Codes are lowercase so they
+// can be used in urls and as banlist_info keys.
+func CreateBanlistFormat(DB *sql.DB, format dbConfig.BanlistFormat) (dbConfig.BanlistFormat, error) {
+	if !formatCodePattern.MatchString(format.Code) {
+		return format, &FormatCodeError{format.Code, "use lowercase letters, digits and underscores"}
+	}
+
+	if contains(reservedFormatCodes, format.Code) {
+		return format, &FormatCodeError{format.Code, "it is taken by the /banlist/" + format.Code + " route"}
+	}
+
+	if strings.TrimSpace(format.Name) == "" {
+		format.Name = strings.ToUpper(format.Code)
+	}
+
+	sqlStatement := fmt.Sprintf(`INSERT INTO %s (code, name) VALUES ($1, $2)`,
+		os.Getenv("BANLIST_FORMATS_TABLE_NAME"))
+
+	_, err := DB.Exec(sqlStatement, format.Code, format.Name)
+
+	return format, err
+}
+
+// NewBanlistVersion describes the version a banlist import writes to. The
+// date defaults to today and the name to the format and date, "TCG 2023-02-06".
+func NewBanlistVersion(format string, name string, date string) (dbConfig.BanlistVersion, error) {
+	version := dbConfig.BanlistVersion{Format: format, Name: name, Effective_date: date}
+
+	if version.Effective_date == "" {
+		version.Effective_date = time.Now().Format(dateLayout)
+	}
+
+	if _, err := time.Parse(dateLayout, version.Effective_date); err != nil {
+		return version, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", version.Effective_date)
+	}
+
+	if version.Name == "" {
+		version.Name = strings.ToUpper(format) + " " + version.Effective_date
+	}
+
+	return version, nil
+}
+
+func createBanlistVersion(tx *sql.Tx, version dbConfig.BanlistVersion) (int, error) {
+	var id int
+
+	sqlStatement := fmt.Sprintf(`
+		INSERT INTO %s (format, name, effective_date) VALUES ($1, $2, $3)
+		RETURNING id`, os.Getenv("BANLIST_VERSIONS_TABLE_NAME"))
+
+	err := tx.QueryRow(sqlStatement, version.Format, version.Name, version.Effective_date).Scan(&id)
+
+	return id, err
+}
+
+// findOrCreateBanlistVersion returns the version of the format in force from
+// the given date, creating it, or renaming it, as needed.
+func findOrCreateBanlistVersion(tx *sql.Tx, version dbConfig.BanlistVersion) (int, error) {
+	var id int
+
+	sqlStatement := fmt.Sprintf(`
+		INSERT INTO %s (format, name, effective_date) VALUES ($1, $2, $3)
+		ON CONFLICT (format, effective_date) DO UPDATE SET name = EXCLUDED.name
+		RETURNING id`, os.Getenv("BANLIST_VERSIONS_TABLE_NAME"))
+
+	err := tx.QueryRow(sqlStatement, version.Format, version.Name, version.Effective_date).Scan(&id)
+
+	return id, err
+}
+
+// banlistStatus picks the status of a YGOPRODeck banlist entry for a format.
+// Its banlist_info is keyed like "ban_tcg"; a plain "tcg" key is accepted for
+// custom formats. An empty result means the entry says nothing about the
+// format: the status of another format is never borrowed.
+func banlistStatus(banlist dbConfig.BanlistJSON, format string) string {
+	if status, ok := banlist.BanlistInfo["ban_"+format]; ok {
+		return status
+	}
+
+	return banlist.BanlistInfo[format]
+}
+
+func GetBanlistVersions(DB *sql.DB, format string) ([]dbConfig.BanlistVersion, error) {
+	sqlStatement := fmt.Sprintf(`
+		SELECT id, format, name, effective_date::text FROM %s
+		WHERE format = $1
+		ORDER BY effective_date DESC`, os.Getenv("BANLIST_VERSIONS_TABLE_NAME"))
+
+	query, err := DB.Query(sqlStatement, format)
+	if checkErr(err) {
+		return []dbConfig.BanlistVersion{}, err
+	}
+	defer query.Close()
+
+	versions := []dbConfig.BanlistVersion{}
+	for query.Next() {
+		var version dbConfig.BanlistVersion
+
+		err = query.Scan(&version.ID, &version.Format, &version.Name, &version.Effective_date)
+		if checkErr(err) {
+			return []dbConfig.BanlistVersion{}, err
+		}
+
+		versions = append(versions, version)
+	}
+
+	return versions, query.Err()
+}
+
+// ResolveBanlistVersion finds the banlist of a format to serve. An explicit
+// version, by name or id, wins; otherwise the version in force on date, or
+// today when date is empty. It returns sql.ErrNoRows when nothing matches.
+func ResolveBanlistVersion(DB *sql.DB, format string, date string, version string) (dbConfig.BanlistVersion, error) {
+	var resolved dbConfig.BanlistVersion
+	var sqlStatement string
+	var arg interface{}
+
+	if version != "" {
+		sqlStatement = fmt.Sprintf(`
+			SELECT id, format, name, effective_date::text FROM %s
+			WHERE format = $1 AND (name = $2 OR id::text = $2)`, os.Getenv("BANLIST_VERSIONS_TABLE_NAME"))
+		arg = version
+	} else {
+		if date == "" {
+			date = time.Now().Format(dateLayout)
+		}
+
+		if _, err := time.Parse(dateLayout, date); err != nil {
+			return resolved, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", date)
+		}
+
+		sqlStatement = fmt.Sprintf(`
+			SELECT id, format, name, effective_date::text FROM %s
+			WHERE format = $1 AND effective_date <= $2
+			ORDER BY effective_date DESC
+			LIMIT 1`, os.Getenv("BANLIST_VERSIONS_TABLE_NAME"))
+		arg = date
+	}
+
+	err := DB.QueryRow(sqlStatement, format, arg).Scan(&resolved.ID, &resolved.Format, &resolved.Name, &resolved.Effective_date)
+
+	return resolved, err
+}
+
+// FindBanlistVersion looks a version of any format up by name or id.
+func FindBanlistVersion(DB *sql.DB, version string) (dbConfig.BanlistVersion, error) {
+	var found dbConfig.BanlistVersion
+
+	sqlStatement := fmt.Sprintf(`
+		SELECT id, format, name, effective_date::text FROM %s
+		WHERE name = $1 OR id::text = $1`, os.Getenv("BANLIST_VERSIONS_TABLE_NAME"))
+
+	err := DB.QueryRow(sqlStatement, version).Scan(&found.ID, &found.Format, &found.Name, &found.Effective_date)
+
+	return found, err
+}
+
+// banlistJoin adds "ban", holding the banlist_info of the card Q: a JSON
+// object with the status of every registered format, taken from the version
+// of that format in force on date, or today when date is empty or not a
+// valid YYYY-MM-DD date. Formats without a row for the card are Unlimited.
+func banlistJoin(q *queryBuilder, date string) string {
+	asOf := banlistAsOf(q, date)
+
+	return fmt.Sprintf(`
+		CROSS JOIN LATERAL (
+			SELECT json_object_agg(f.code, COALESCE(e.status, 'Unlimited')) as banlist_info
+			FROM %s f
+			LEFT JOIN LATERAL (
+				SELECT v.id FROM %s v
+				WHERE v.format = f.code AND v.effective_date <= %s
+				ORDER BY v.effective_date DESC
+				LIMIT 1
+			) as cv ON true
+			LEFT JOIN %s e ON e.version_id = cv.id AND e.card_id = Q.id
+		) as ban`, os.Getenv("BANLIST_FORMATS_TABLE_NAME"), os.Getenv("BANLIST_VERSIONS_TABLE_NAME"),
+		asOf, os.Getenv("BANLIST_ENTRIES_TABLE_NAME"))
+}
+
+// banlistAsOf is the day banlists are read at: date, or today when date is
+// empty or not a valid YYYY-MM-DD date.
+func banlistAsOf(q *queryBuilder, date string) string {
+	if _, err := time.Parse(dateLayout, date); err == nil {
+		return q.arg(date) + "::date"
+	}
+
+	return "current_date"
+}
+
+// BanlistStatusKey tells whether a filter key like tcg_status asks for a
+// banlist status, and of which format.
+func BanlistStatusKey(key string) (string, bool) {
+	format := strings.TrimSuffix(key, "_status")
+
+	return format, format != key && formatCodePattern.MatchString(format)
+}
+
+// UnknownFormatError is a <format>_status filter naming a format that is not
+// registered, which would otherwise match no card, or every card.
+type UnknownFormatError struct {
+	Key    string
+	Format string
+}
+
+func (err *UnknownFormatError) Error() string {
+	return fmt.Sprintf("invalid %s, %q is not a banlist format", err.Key, err.Format)
+}
+
+// checkBanlistFormats makes sure every banlist status filter of filterMap
+// names a registered format.
+func checkBanlistFormats(DB *sql.DB, filterMap map[string]string) error {
+	for key, value := range filterMap {
+		format, ok := BanlistStatusKey(key)
+		if !ok || value == "" {
+			continue
+		}
+
+		_, err := GetBanlistFormat(DB, format)
+		if err == sql.ErrNoRows {
+			return &UnknownFormatError{Key: key, Format: format}
+		}
+
+		if checkErr(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// banlistStatusFilter matches cards whose status in format, as of date, is
+// one of value's comma separated statuses, or none of them after a leading
+// "!". Cards without an entry in the version in force are Unlimited, like in
+// banlistJoin.
+func banlistStatusFilter(q *queryBuilder, key string, format string, value string, date string) (string, error) {
+	negate := strings.HasPrefix(value, "!")
+	value = strings.TrimPrefix(value, "!")
+
+	wanted := map[string]bool{}
+	for _, status := range splitList(value) {
+		found := false
+		for _, known := range dbConfig.BanlistStatuses {
+			if strings.EqualFold(status, known) {
+				wanted[known] = true
+				found = true
+			}
+		}
+
+		if !found {
+			return "", &FilterError{key, status, strings.Join(dbConfig.BanlistStatuses, ", ")}
+		}
+	}
+
+	if len(wanted) == 0 {
+		return "", &FilterError{key, "", "at least one status"}
+	}
+
+	statuses := []string{}
+	for _, status := range dbConfig.BanlistStatuses {
+		if wanted[status] != negate {
+			statuses = append(statuses, status)
+		}
+	}
+
+	// Allowing Unlimited, the cards to leave out are the ones listed with
+	// any other status
+	membership, comparison := "IN", "= ANY"
+	if contains(statuses, "Unlimited") {
+		membership, comparison = "NOT IN", "<> ALL"
+	}
+
+	return fmt.Sprintf(`id %s (
+		SELECT e.card_id FROM %s e
+		WHERE e.version_id = (
+			SELECT v.id FROM %s v
+			WHERE v.format = %s AND v.effective_date <= %s
+			ORDER BY v.effective_date DESC
+			LIMIT 1
+		) AND e.status %s(%s::text[])
+	)`, membership, os.Getenv("BANLIST_ENTRIES_TABLE_NAME"), os.Getenv("BANLIST_VERSIONS_TABLE_NAME"),
+		q.arg(format), banlistAsOf(q, date), comparison, q.arg(pq.StringArray(statuses))), nil
+}
+
+// DiffBanlists lists every card whose status differs between two versions,
+// which may belong to different formats. A card missing from a version is
+// Unlimited there, the same default card responses use.
+func DiffBanlists(DB *sql.DB, from dbConfig.BanlistVersion, to dbConfig.BanlistVersion) (dbConfig.BanlistDiff, error) {
+	diff := dbConfig.BanlistDiff{
+		From: from,
+		To:   to,
+		Changes: dbConfig.BanlistChanges{
+			Forbidden:    []dbConfig.BanlistChange{},
+			Limited:      []dbConfig.BanlistChange{},
+			Semi_limited: []dbConfig.BanlistChange{},
+			Unlimited:    []dbConfig.BanlistChange{},
+		},
+	}
+
+	entryTable := os.Getenv("BANLIST_ENTRIES_TABLE_NAME")
+	sqlStatement := fmt.Sprintf(`
+		SELECT card_id, from_status, to_status FROM (
+			SELECT COALESCE(f.card_id, t.card_id) as card_id,
+			COALESCE(f.status, 'Unlimited') as from_status,
+			COALESCE(t.status, 'Unlimited') as to_status
+			FROM (SELECT * FROM %s WHERE version_id = $1) as f
+			FULL OUTER JOIN (SELECT * FROM %s WHERE version_id = $2) as t ON f.card_id = t.card_id
+		) as D
+		WHERE from_status <> to_status`, entryTable, entryTable)
+
+	query, err := DB.Query(sqlStatement, from.ID, to.ID)
+	if checkErr(err) {
+		return diff, err
+	}
+	defer query.Close()
+
+	ids := []string{}
+	statuses := map[int][2]string{}
+	for query.Next() {
+		var id int
+		var fromStatus, toStatus string
+
+		err = query.Scan(&id, &fromStatus, &toStatus)
+		if checkErr(err) {
+			return diff, err
+		}
+
+		ids = append(ids, strconv.Itoa(id))
+		statuses[id] = [2]string{fromStatus, toStatus}
+	}
+
+	if checkErr(query.Err()) || len(ids) == 0 {
+		return diff, query.Err()
+	}
+
+	filterMap := map[string]string{"ids": strings.Join(ids, ",")}
+	cards, err := GetCardsInDB(DB, filterMap, 0, 0, "getByIds")
+	if checkErr(err) {
+		return diff, err
+	}
+
+	for _, card := range cards {
+		change := dbConfig.BanlistChange{From: statuses[card.ID][0], To: statuses[card.ID][1], Card: card}
+
+		switch change.To {
+		case "Forbidden":
+			diff.Changes.Forbidden = append(diff.Changes.Forbidden, change)
+		case "Limited":
+			diff.Changes.Limited = append(diff.Changes.Limited, change)
+		case "Semi-Limited":
+			diff.Changes.Semi_limited = append(diff.Changes.Semi_limited, change)
+		default:
+			diff.Changes.Unlimited = append(diff.Changes.Unlimited, change)
+		}
+	}
+
+	return diff, nil
+}
+
+func atoiOrZero(value string) int {
+	integer, err := strconv.Atoi(value)
+	if err != nil {
+		return 0
+	}
+
+	return integer
+}
@@ -0,0 +1,20 @@
+package dbutils
+
+import (
+	"errors"
+	"testing"
+
+	dbConfig "Yu-Go-Oh-API/gopostgres/dbconfig"
+)
+
+// Refused codes never reach the database, so no connection is needed.
+func TestCreateBanlistFormatRejectsCodes(t *testing.T) {
+	for _, code := range []string{"", "Edison", "goat-format", "diff", "formats", "load"} {
+		_, err := CreateBanlistFormat(nil, dbConfig.BanlistFormat{Code: code})
+
+		var codeErr *FormatCodeError
+		if !errors.As(err, &codeErr) {
+			t.Errorf("CreateBanlistFormat(%q) error = %v, want a FormatCodeError", code, err)
+		}
+	}
+}
@@ -0,0 +1,444 @@
+package dbutils
+
+import (
+	"database/sql"
+	"fmt"
+
+	dbConfig "Yu-Go-Oh-API/gopostgres/dbconfig"
+	dbJobs "Yu-Go-Oh-API/gopostgres/dbjobs"
+
+	pq "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"gopkg.in/guregu/null.v4"
+)
+
+// Bits of the datas.type column of a cards.cdb, as YGOPro and EDOPro define them
+const (
+	cdbTypeMonster    = 0x1
+	cdbTypeSpell      = 0x2
+	cdbTypeTrap       = 0x4
+	cdbTypeNormal     = 0x10
+	cdbTypeEffect     = 0x20
+	cdbTypeFusion     = 0x40
+	cdbTypeRitual     = 0x80
+	cdbTypeSpirit     = 0x200
+	cdbTypeUnion      = 0x400
+	cdbTypeGemini     = 0x800
+	cdbTypeTuner      = 0x1000
+	cdbTypeSynchro    = 0x2000
+	cdbTypeToken      = 0x4000
+	cdbTypeQuickPlay  = 0x10000
+	cdbTypeContinuous = 0x20000
+	cdbTypeEquip      = 0x40000
+	cdbTypeField      = 0x80000
+	cdbTypeCounter    = 0x100000
+	cdbTypeFlip       = 0x200000
+	cdbTypeToon       = 0x400000
+	cdbTypeXyz        = 0x800000
+	cdbTypePendulum   = 0x1000000
+	cdbTypeLink       = 0x4000000
+	cdbTypeSkill      = 0x8000000
+)
+
+// cdbRaces and cdbAttributes list the names of the datas.race and
+// datas.attribute bits, lowest bit first.
+var cdbRaces = []string{
+	"Warrior", "Spellcaster", "Fairy", "Fiend", "Zombie", "Machine", "Aqua", "Pyro",
+	"Rock", "Winged Beast", "Plant", "Insect", "Thunder", "Dragon", "Beast", "Beast-Warrior",
+	"Dinosaur", "Fish", "Sea Serpent", "Reptile", "Psychic", "Divine-Beast", "Creator-God", "Wyrm",
+	"Cyberse", "Illusion",
+}
+
+var cdbAttributes = []string{"EARTH", "WATER", "FIRE", "WIND", "LIGHT", "DARK", "DIVINE"}
+
+// Link monsters keep their arrows in datas.def, one bit per cell of a 3x3
+// grid counted from the bottom left; 0x10, the centre, is never set.
+var cdbLinkMarkers = []cdbBit{
+	{0x40, "Top-Left"}, {0x80, "Top"}, {0x100, "Top-Right"},
+	{0x8, "Left"}, {0x20, "Right"},
+	{0x1, "Bottom-Left"}, {0x2, "Bottom"}, {0x4, "Bottom-Right"},
+}
+
+// Images are not part of a cards.cdb; YGOPRODeck serves them by passcode.
+const cdbImageUrl = "https://images.ygoprodeck.com/images/%s/%d.jpg"
+
+// An alias closer than this to the card id marks an alternate artwork
+// rather than a card that is only treated as another one.
+const cdbArtworkRange = 10
+
+type cdbBit struct {
+	bit  int64
+	name string
+}
+
+// The first match picks the frameType, "effect" when none does.
+var cdbFrameTypes = []cdbBit{
+	{cdbTypeLink, "link"}, {cdbTypeXyz, "xyz"}, {cdbTypeSynchro, "synchro"},
+	{cdbTypeFusion, "fusion"}, {cdbTypeRitual, "ritual"}, {cdbTypeNormal, "normal"},
+}
+
+// typeline follows the race with every matching kind, in this order.
+var cdbTypelineKinds = []cdbBit{
+	{cdbTypeFusion, "Fusion"}, {cdbTypeRitual, "Ritual"}, {cdbTypeSynchro, "Synchro"},
+	{cdbTypeXyz, "Xyz"}, {cdbTypeLink, "Link"}, {cdbTypePendulum, "Pendulum"},
+	{cdbTypeTuner, "Tuner"}, {cdbTypeFlip, "Flip"}, {cdbTypeGemini, "Gemini"},
+	{cdbTypeSpirit, "Spirit"}, {cdbTypeToon, "Toon"}, {cdbTypeUnion, "Union"},
+	{cdbTypeNormal, "Normal"}, {cdbTypeEffect, "Effect"},
+}
+
+type cdbRow struct {
+	id, ot, alias, cardType, atk, def, level, race, attribute int64
+	name, desc                                                string
+}
+
+// CardsCDBPath is the cards.cdb read when a cdb import carries no upload.
+func CardsCDBPath() string {
+	return envOrDefault("CARDS_CDB_PATH", "cards.cdb")
+}
+
+// cdbColumns are the card columns a cards.cdb has values for. Archetypes,
+// YGOPRODeck urls, Konami ids and release dates are not in it, and its
+// formats only tell TCG from OCG, so cards the JSON catalogue loaded keep
+// theirs.
+var cdbColumns = []string{
+	"card_name", "card_type", "description", "atk", "def", "card_level", "race", "attr",
+	"linkval", "linkmarkers", "card_scale", "frame_type", "typeline", "has_effect",
+}
+
+// LoadCardsCDB works like LoadCardsJSON for a YGOPro/EDOPro cards.cdb. A cdb
+// usually holds pre-release or custom cards rather than the whole catalogue,
+// so anything but a dry run merges it into the loaded cards.
+func LoadCardsCDB(DB *sql.DB, path string, mode string, job *dbJobs.Job) (dbConfig.ImportResult, error) {
+	if mode != "dryRun" {
+		mode = "merge"
+	}
+
+	return loadCards(DB, path, mode, validateCardFile(readCDB), readCDB, job)
+}
+
+// readCDB is the CardReader of cards.cdb files. Alternate artworks are
+// stored as cards of their own there and are folded into the images of the
+// card they alias, the way YGOPRODeck lists them.
+func readCDB(path string, handle func(cards []dbConfig.CardDB) error) (int, error) {
+	cdb, err := sql.Open(dbConfig.SqliteDriver, "file:"+path+"?mode=ro")
+	if checkErr(err) {
+		return 0, err
+	}
+	defer cdb.Close()
+
+	query, err := cdb.Query(`
+		SELECT d.id, d.ot, d.alias, d.type, d.atk, d.def, d.level, d.race, d.attribute,
+		COALESCE(t.name, ''), COALESCE(t.desc, '')
+		FROM datas d JOIN texts t ON t.id = d.id
+		ORDER BY d.id`)
+	if checkErr(err) {
+		return 0, fmt.Errorf("reading cards.cdb: %w", err)
+	}
+	defer query.Close()
+
+	rows := []cdbRow{}
+	for query.Next() {
+		var row cdbRow
+
+		err = query.Scan(&row.id, &row.ot, &row.alias, &row.cardType, &row.atk, &row.def,
+			&row.level, &row.race, &row.attribute, &row.name, &row.desc)
+		if checkErr(err) {
+			return 0, fmt.Errorf("card %d: %w", len(rows)+1, err)
+		}
+
+		rows = append(rows, row)
+	}
+
+	if checkErr(query.Err()) {
+		return 0, query.Err()
+	}
+
+	cards := decodeCDBRows(rows)
+
+	for start := 0; start < len(cards); start += importBatchSize {
+		end := start + importBatchSize
+		if end > len(cards) {
+			end = len(cards)
+		}
+
+		err = handle(cards[start:end])
+		if checkErr(err) {
+			return start, err
+		}
+	}
+
+	return len(cards), nil
+}
+
+// decodeCDBRows decodes every row that is a card of its own and adds the
+// alternate artworks to the images of the card they alias. An artwork whose
+// card is missing from the rows stays a card.
+func decodeCDBRows(rows []cdbRow) []dbConfig.CardDB {
+	present := map[int64]bool{}
+	for _, row := range rows {
+		present[row.id] = true
+	}
+
+	cards := []dbConfig.CardDB{}
+	index := map[int64]int{}
+	artworks := []cdbRow{}
+	for _, row := range rows {
+		if isCDBArtwork(row) && present[row.alias] {
+			artworks = append(artworks, row)
+			continue
+		}
+
+		index[row.id] = len(cards)
+		cards = append(cards, decodeCDBRow(row))
+	}
+
+	for _, artwork := range artworks {
+		card := &cards[index[artwork.alias]]
+		card.Images = append(card.Images, cdbImage(artwork.id))
+	}
+
+	return cards
+}
+
+func isCDBArtwork(row cdbRow) bool {
+	distance := row.id - row.alias
+	if distance < 0 {
+		distance = -distance
+	}
+
+	return row.alias != 0 && distance < cdbArtworkRange
+}
+
+func cdbImage(id int64) dbConfig.CardImageDB {
+	return dbConfig.CardImageDB{
+		ID:                int(id),
+		Image_url:         fmt.Sprintf(cdbImageUrl, "cards", id),
+		Image_url_small:   fmt.Sprintf(cdbImageUrl, "cards_small", id),
+		Image_url_cropped: fmt.Sprintf(cdbImageUrl, "cards_cropped", id),
+	}
+}
+
+// decodeCDBRow turns a datas/texts row into the card YGOPRODeck would serve.
+func decodeCDBRow(row cdbRow) dbConfig.CardDB {
+	card := dbConfig.CardDB{
+		ID:          int(row.id),
+		Card_Name:   row.name,
+		Description: row.desc,
+		Images:      []dbConfig.CardImageDB{cdbImage(row.id)},
+	}
+
+	misc := dbConfig.CardMiscInfoDB{Formats: cdbFormats(row.ot)}
+
+	switch {
+	case row.cardType&cdbTypeSpell != 0:
+		card.Card_Type = "Spell Card"
+		card.FrameType = null.StringFrom("spell")
+		card.Race = null.StringFrom(cdbSpellTrapRace(row.cardType))
+	case row.cardType&cdbTypeTrap != 0:
+		card.Card_Type = "Trap Card"
+		card.FrameType = null.StringFrom("trap")
+		card.Race = null.StringFrom(cdbSpellTrapRace(row.cardType))
+	case row.cardType&cdbTypeSkill != 0:
+		card.Card_Type = "Skill Card"
+		card.FrameType = null.StringFrom("skill")
+	default:
+		decodeCDBMonster(row, &card)
+
+		if row.cardType&cdbTypeMonster != 0 {
+			misc.Has_effect = null.IntFrom(0)
+			if row.cardType&cdbTypeEffect != 0 {
+				misc.Has_effect = null.IntFrom(1)
+			}
+		}
+	}
+
+	card.MiscInfo = []dbConfig.CardMiscInfoDB{misc}
+
+	return card
+}
+
+// decodeCDBMonster fills in the monster fields. datas.level packs the level,
+// or link rating, in its low byte and the pendulum scales in its high bytes;
+// an ATK or DEF of -2 is "?".
+func decodeCDBMonster(row cdbRow, card *dbConfig.CardDB) {
+	isLink := row.cardType&cdbTypeLink != 0
+	isPendulum := row.cardType&cdbTypePendulum != 0
+
+	race := cdbBitName(row.race, cdbRaces)
+	if race != "" {
+		card.Race = null.StringFrom(race)
+	}
+
+	attribute := cdbBitName(row.attribute, cdbAttributes)
+	if attribute != "" {
+		card.Attr = null.StringFrom(attribute)
+	}
+
+	if row.atk != -2 {
+		card.Atk = null.IntFrom(row.atk)
+	}
+
+	if isLink {
+		card.Linkval = null.IntFrom(row.level & 0xff)
+		card.Linkmarkers = pq.StringArray{}
+		for _, marker := range cdbLinkMarkers {
+			if row.def&marker.bit != 0 {
+				card.Linkmarkers = append(card.Linkmarkers, marker.name)
+			}
+		}
+	} else {
+		card.Card_Level = null.IntFrom(row.level & 0xff)
+		if row.def != -2 {
+			card.Def = null.IntFrom(row.def)
+		}
+	}
+
+	if isPendulum {
+		card.Card_Scale = null.IntFrom((row.level >> 24) & 0xff)
+	}
+
+	if row.cardType&cdbTypeToken != 0 {
+		card.Card_Type = "Token"
+		card.FrameType = null.StringFrom("token")
+		return
+	}
+
+	card.Card_Type = cdbMonsterType(row.cardType)
+
+	frameType := "effect"
+	for _, kind := range cdbFrameTypes {
+		if row.cardType&kind.bit != 0 {
+			frameType = kind.name
+			break
+		}
+	}
+
+	if isPendulum {
+		frameType = frameType + "_pendulum"
+	}
+
+	card.FrameType = null.StringFrom(frameType)
+
+	card.Typeline = pq.StringArray{}
+	if race != "" {
+		card.Typeline = append(card.Typeline, race)
+	}
+
+	for _, kind := range cdbTypelineKinds {
+		if row.cardType&kind.bit != 0 {
+			card.Typeline = append(card.Typeline, kind.name)
+		}
+	}
+}
+
+// cdbMonsterType names a monster the way YGOPRODeck's type field does,
+// word order quirks included.
+func cdbMonsterType(cardType int64) string {
+	is := func(bit int64) bool {
+		return cardType&bit != 0
+	}
+
+	if is(cdbTypePendulum) {
+		switch {
+		case is(cdbTypeFusion):
+			return "Pendulum Effect Fusion Monster"
+		case is(cdbTypeSynchro):
+			return "Synchro Pendulum Effect Monster"
+		case is(cdbTypeXyz):
+			return "XYZ Pendulum Effect Monster"
+		case is(cdbTypeRitual):
+			return "Pendulum Effect Ritual Monster"
+		case is(cdbTypeNormal):
+			return "Pendulum Normal Monster"
+		case is(cdbTypeFlip):
+			return "Pendulum Flip Effect Monster"
+		case is(cdbTypeTuner):
+			return "Pendulum Tuner Effect Monster"
+		}
+
+		return "Pendulum Effect Monster"
+	}
+
+	switch {
+	case is(cdbTypeLink):
+		return "Link Monster"
+	case is(cdbTypeFusion):
+		return "Fusion Monster"
+	case is(cdbTypeSynchro) && is(cdbTypeTuner):
+		return "Synchro Tuner Monster"
+	case is(cdbTypeSynchro):
+		return "Synchro Monster"
+	case is(cdbTypeXyz):
+		return "XYZ Monster"
+	case is(cdbTypeRitual) && is(cdbTypeEffect):
+		return "Ritual Effect Monster"
+	case is(cdbTypeRitual):
+		return "Ritual Monster"
+	case is(cdbTypeFlip) && is(cdbTypeTuner):
+		return "Flip Tuner Effect Monster"
+	case is(cdbTypeFlip):
+		return "Flip Effect Monster"
+	case is(cdbTypeGemini):
+		return "Gemini Monster"
+	case is(cdbTypeSpirit):
+		return "Spirit Monster"
+	case is(cdbTypeToon):
+		return "Toon Monster"
+	case is(cdbTypeUnion):
+		return "Union Effect Monster"
+	case is(cdbTypeTuner) && is(cdbTypeNormal):
+		return "Normal Tuner Monster"
+	case is(cdbTypeTuner):
+		return "Tuner Monster"
+	case is(cdbTypeNormal):
+		return "Normal Monster"
+	}
+
+	return "Effect Monster"
+}
+
+func cdbSpellTrapRace(cardType int64) string {
+	switch {
+	case cardType&cdbTypeQuickPlay != 0:
+		return "Quick-Play"
+	case cardType&cdbTypeContinuous != 0:
+		return "Continuous"
+	case cardType&cdbTypeEquip != 0:
+		return "Equip"
+	case cardType&cdbTypeField != 0:
+		return "Field"
+	case cardType&cdbTypeRitual != 0:
+		return "Ritual"
+	case cardType&cdbTypeCounter != 0:
+		return "Counter"
+	}
+
+	return "Normal"
+}
+
+// cdbFormats reads the ot column: 0x1 is OCG and 0x2 TCG.
+func cdbFormats(ot int64) pq.StringArray {
+	formats := pq.StringArray{}
+
+	if ot&0x2 != 0 {
+		formats = append(formats, "TCG")
+	}
+
+	if ot&0x1 != 0 {
+		formats = append(formats, "OCG")
+	}
+
+	return formats
+}
+
+// cdbBitName returns the name of the lowest set bit of value, or "" when
+// none of names applies.
+func cdbBitName(value int64, names []string) string {
+	for bit, name := range names {
+		if value&(1<<bit) != 0 {
+			return name
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,185 @@
+package dbutils
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	dbConfig "Yu-Go-Oh-API/gopostgres/dbconfig"
+
+	"gopkg.in/guregu/null.v4"
+)
+
+// cdbCard is the part of a decoded card the tests compare, with nulls
+// written as "-".
+type cdbCard struct {
+	cardType, frameType, race, attribute string
+	atk, def, level, linkval, scale      string
+	linkmarkers, typeline, formats       string
+	hasEffect                            string
+}
+
+func nullString(value null.String) string {
+	if !value.Valid {
+		return "-"
+	}
+
+	return value.String
+}
+
+func nullInt(value null.Int) string {
+	if !value.Valid {
+		return "-"
+	}
+
+	return fmt.Sprint(value.Int64)
+}
+
+func summarizeCDBCard(card dbConfig.CardDB) cdbCard {
+	return cdbCard{
+		cardType:    card.Card_Type,
+		frameType:   nullString(card.FrameType),
+		race:        nullString(card.Race),
+		attribute:   nullString(card.Attr),
+		atk:         nullInt(card.Atk),
+		def:         nullInt(card.Def),
+		level:       nullInt(card.Card_Level),
+		linkval:     nullInt(card.Linkval),
+		scale:       nullInt(card.Card_Scale),
+		linkmarkers: strings.Join(card.Linkmarkers, ","),
+		typeline:    strings.Join(card.Typeline, ","),
+		formats:     strings.Join(card.MiscInfo[0].Formats, ","),
+		hasEffect:   nullInt(card.MiscInfo[0].Has_effect),
+	}
+}
+
+func TestDecodeCDBRow(t *testing.T) {
+	tests := []struct {
+		name string
+		row  cdbRow
+		card cdbCard
+	}{
+		{
+			name: "normal monster",
+			row: cdbRow{id: 46986414, ot: 0x3, cardType: cdbTypeMonster | cdbTypeNormal,
+				atk: 2500, def: 2100, level: 7, race: 0x2, attribute: 0x20},
+			card: cdbCard{"Normal Monster", "normal", "Spellcaster", "DARK", "2500", "2100", "7", "-", "-",
+				"", "Spellcaster,Normal", "TCG,OCG", "0"},
+		},
+		{
+			name: "link monster",
+			row: cdbRow{id: 1861629, ot: 0x2, cardType: cdbTypeMonster | cdbTypeEffect | cdbTypeLink,
+				atk: 2300, def: 0x80 | 0x1 | 0x4, level: 3, race: 0x1000000, attribute: 0x20},
+			card: cdbCard{"Link Monster", "link", "Cyberse", "DARK", "2300", "-", "-", "3", "-",
+				"Top,Bottom-Left,Bottom-Right", "Cyberse,Link,Effect", "TCG", "1"},
+		},
+		{
+			name: "pendulum monster",
+			row: cdbRow{id: 16178681, ot: 0x3, cardType: cdbTypeMonster | cdbTypeEffect | cdbTypePendulum,
+				atk: 2500, def: 2000, level: 4<<24 | 4<<16 | 7, race: 0x2000, attribute: 0x20},
+			card: cdbCard{"Pendulum Effect Monster", "effect_pendulum", "Dragon", "DARK", "2500", "2000", "7", "-", "4",
+				"", "Dragon,Pendulum,Effect", "TCG,OCG", "1"},
+		},
+		{
+			name: "synchro tuner with ? ATK and DEF",
+			row: cdbRow{id: 1, ot: 0x1, cardType: cdbTypeMonster | cdbTypeEffect | cdbTypeTuner | cdbTypeSynchro,
+				atk: -2, def: -2, level: 8, race: 0x1, attribute: 0x10},
+			card: cdbCard{"Synchro Tuner Monster", "synchro", "Warrior", "LIGHT", "-", "-", "8", "-", "-",
+				"", "Warrior,Synchro,Tuner,Effect", "OCG", "1"},
+		},
+		{
+			name: "token",
+			row: cdbRow{id: 2, cardType: cdbTypeMonster | cdbTypeNormal | cdbTypeToken,
+				level: 1, race: 0x4000, attribute: 0x1},
+			card: cdbCard{"Token", "token", "Beast", "EARTH", "0", "0", "1", "-", "-",
+				"", "", "", "0"},
+		},
+		{
+			name: "quick-play spell",
+			row:  cdbRow{id: 5318639, ot: 0x3, cardType: cdbTypeSpell | cdbTypeQuickPlay},
+			card: cdbCard{"Spell Card", "spell", "Quick-Play", "-", "-", "-", "-", "-", "-",
+				"", "", "TCG,OCG", "-"},
+		},
+		{
+			name: "continuous trap",
+			row:  cdbRow{id: 44095762, ot: 0x3, cardType: cdbTypeTrap | cdbTypeContinuous},
+			card: cdbCard{"Trap Card", "trap", "Continuous", "-", "-", "-", "-", "-", "-",
+				"", "", "TCG,OCG", "-"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			card := decodeCDBRow(test.row)
+
+			if got := summarizeCDBCard(card); got != test.card {
+				t.Errorf("decoded\n%+v\nwant\n%+v", got, test.card)
+			}
+
+			if card.ID != int(test.row.id) || len(card.Images) != 1 || card.Images[0].ID != int(test.row.id) {
+				t.Errorf("id %d with images %v, want only its own artwork", card.ID, card.Images)
+			}
+		})
+	}
+}
+
+func TestCDBMonsterType(t *testing.T) {
+	tests := map[int64]string{
+		cdbTypeMonster | cdbTypeEffect | cdbTypeFusion:                    "Fusion Monster",
+		cdbTypeMonster | cdbTypeEffect | cdbTypeXyz:                       "XYZ Monster",
+		cdbTypeMonster | cdbTypeRitual:                                    "Ritual Monster",
+		cdbTypeMonster | cdbTypeEffect | cdbTypeRitual:                    "Ritual Effect Monster",
+		cdbTypeMonster | cdbTypeEffect | cdbTypeFlip:                      "Flip Effect Monster",
+		cdbTypeMonster | cdbTypeNormal | cdbTypeTuner:                     "Normal Tuner Monster",
+		cdbTypeMonster | cdbTypeEffect | cdbTypeXyz | cdbTypePendulum:     "XYZ Pendulum Effect Monster",
+		cdbTypeMonster | cdbTypeEffect | cdbTypeSynchro | cdbTypePendulum: "Synchro Pendulum Effect Monster",
+		cdbTypeMonster | cdbTypeNormal | cdbTypePendulum:                  "Pendulum Normal Monster",
+		cdbTypeMonster | cdbTypeEffect | cdbTypeFusion | cdbTypePendulum:  "Pendulum Effect Fusion Monster",
+		cdbTypeMonster | cdbTypeEffect | cdbTypeTuner | cdbTypePendulum:   "Pendulum Tuner Effect Monster",
+		cdbTypeMonster | cdbTypeEffect | cdbTypeGemini:                    "Gemini Monster",
+		cdbTypeMonster | cdbTypeEffect | cdbTypeUnion:                     "Union Effect Monster",
+		cdbTypeMonster | cdbTypeEffect:                                    "Effect Monster",
+	}
+
+	for cardType, want := range tests {
+		if got := cdbMonsterType(cardType); got != want {
+			t.Errorf("cdbMonsterType(%#x) = %q, want %q", cardType, got, want)
+		}
+	}
+}
+
+func TestDecodeCDBRowsFoldsArtworks(t *testing.T) {
+	monster := cdbTypeMonster | cdbTypeNormal
+	rows := []cdbRow{
+		{id: 89631139, cardType: int64(monster), name: "Blue-Eyes White Dragon"},
+		{id: 89631140, alias: 89631139, cardType: int64(monster), name: "Blue-Eyes White Dragon"},
+		{id: 89631141, alias: 89631139, cardType: int64(monster), name: "Blue-Eyes White Dragon"},
+		// An alias far from the id is a card treated as another one
+		{id: 91932350, alias: 76812113, cardType: int64(monster), name: "Harpie Lady 1"},
+		// An artwork of a card the cdb does not have stays a card
+		{id: 46986415, alias: 46986414, cardType: int64(monster), name: "Dark Magician"},
+	}
+
+	cards := decodeCDBRows(rows)
+
+	images := map[int][]int{}
+	for _, card := range cards {
+		for _, image := range card.Images {
+			images[card.ID] = append(images[card.ID], image.ID)
+		}
+	}
+
+	want := map[int][]int{
+		89631139: {89631139, 89631140, 89631141},
+		91932350: {91932350},
+		46986415: {46986415},
+	}
+	if !reflect.DeepEqual(images, want) {
+		t.Errorf("images by card = %v, want %v", images, want)
+	}
+
+	if url := cards[0].Images[1].Image_url; url != "https://images.ygoprodeck.com/images/cards/89631140.jpg" {
+		t.Errorf("artwork url = %q", url)
+	}
+}
@@ -0,0 +1,543 @@
+package dbutils
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	dbConfig "Yu-Go-Oh-API/gopostgres/dbconfig"
+	dbJobs "Yu-Go-Oh-API/gopostgres/dbjobs"
+
+	pq "github.com/lib/pq"
+	"gopkg.in/guregu/null.v4"
+)
+
+// Cards are streamed to Postgres with COPY in batches; every batch shares
+// the import transaction, so a failure rolls back the whole catalogue.
+const importBatchSize = 1000
+
+var cardColumns = []string{
+	"id", "card_name", "card_type", "description", "archetype", "atk", "def",
+	"card_level", "race", "attr", "linkval", "linkmarkers", "card_scale",
+	"frame_type", "typeline", "ygoprodeck_url", "konami_id", "tcg_date", "ocg_date",
+	"has_effect", "formats",
+}
+
+var imageColumns = []string{"id", "card_id", "image_url", "image_url_small", "image_url_cropped"}
+
+// cardTables names the tables a batch of cards is copied into: the real
+// tables for a plain import, staging tables for a sync. Printings and prices
+// always go through staging because they are written once every card is in.
+type cardTables struct {
+	cards     string
+	images    string
+	printings string
+	prices    string
+}
+
+func copyCardsToDB(cards []dbConfig.CardDB, tx *sql.Tx, tables cardTables) error {
+	cardRows := [][]interface{}{}
+	imageRows := [][]interface{}{}
+	printingRows := [][]interface{}{}
+	priceRows := [][]interface{}{}
+
+	for _, card := range cards {
+		// YGOPRODeck nests the release metadata in a one element misc_info array
+		var misc dbConfig.CardMiscInfoDB
+		if len(card.MiscInfo) > 0 {
+			misc = card.MiscInfo[0]
+		}
+
+		var hasEffect interface{}
+		if misc.Has_effect.Valid {
+			hasEffect = misc.Has_effect.Int64 != 0
+		}
+
+		cardRows = append(cardRows, []interface{}{
+			card.ID, card.Card_Name, card.Card_Type, card.Description, card.Archetype,
+			card.Atk, card.Def, card.Card_Level, card.Race, card.Attr, card.Linkval, card.Linkmarkers, card.Card_Scale,
+			card.FrameType, card.Typeline, card.Ygoprodeck_url, misc.Konami_id,
+			nullDate(misc.Tcg_date), nullDate(misc.Ocg_date), hasEffect, misc.Formats,
+		})
+
+		for _, image := range card.Images {
+			imageRows = append(imageRows, []interface{}{
+				image.ID, card.ID, image.Image_url, image.Image_url_small, image.Image_url_cropped,
+			})
+		}
+
+		for _, set := range card.Sets {
+			printingRows = append(printingRows, []interface{}{
+				card.ID, set.Set_name, setCodePrefix(set.Set_code), set.Set_code,
+				set.Set_rarity, set.Set_rarity_code, nullPrice(set.Set_price),
+			})
+		}
+
+		priceRows = append(priceRows, cardPriceRows(card)...)
+	}
+
+	err := copyToDB(tx, tables.cards, cardColumns, cardRows)
+	if checkErr(err) {
+		return err
+	}
+
+	err = copyToDB(tx, tables.images, imageColumns, imageRows)
+	if checkErr(err) {
+		return err
+	}
+
+	err = copyToDB(tx, tables.printings, printingStagingColumns, printingRows)
+	if checkErr(err) {
+		return err
+	}
+
+	return copyToDB(tx, tables.prices, priceStagingColumns, priceRows)
+}
+
+// AddBanlistToDB stores the status an entry gives the format in a version.
+// Entries without a status for the format are skipped, they are Unlimited.
+func AddBanlistToDB(banlist dbConfig.BanlistJSON, tx *sql.Tx, format string, versionId int) error {
+	status := banlistStatus(banlist, format)
+	if status == "" {
+		return nil
+	}
+
+	filterMap := map[string]string{
+		"table": os.Getenv("BANLIST_ENTRIES_TABLE_NAME"),
+	}
+
+	sqlStatement, _, _, _ := writeSQLStatement("postBanlist", filterMap, 0, 0)
+
+	return prepareExecToDB(
+		sqlStatement, tx,
+		versionId, banlist.ID, status,
+	)
+}
+
+func nullDate(date null.String) interface{} {
+	if !date.Valid || date.String == "" {
+		return nil
+	}
+
+	return date.String
+}
+
+func nullPrice(price string) interface{} {
+	if price == "" {
+		return nil
+	}
+
+	return price
+}
+
+func copyToDB(tx *sql.Tx, table string, columns []string, rows [][]interface{}) error {
+	stmt, err := tx.Prepare(pq.CopyIn(table, columns...))
+	if checkErr(err) {
+		return err
+	}
+
+	for _, row := range rows {
+		_, err = stmt.Exec(row...)
+		if checkErr(err) {
+			stmt.Close()
+			return fmt.Errorf("copy into %s: %w", table, err)
+		}
+	}
+
+	// An Exec without arguments flushes the buffered rows
+	_, err = stmt.Exec()
+	if checkErr(err) {
+		stmt.Close()
+		return fmt.Errorf("copy into %s: %w", table, err)
+	}
+
+	fmt.Printf("Rows copied into %s: %d \n", table, len(rows))
+
+	return stmt.Close()
+}
+
+func prepareExecToDB(sqlStatement string, tx *sql.Tx, args ...interface{}) error {
+	insert, err := tx.Prepare(sqlStatement)
+	if checkErr(err) {
+		return err
+	}
+	defer insert.Close()
+
+	result, err := insert.Exec(args...)
+	if checkErr(err) {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if checkErr(err) {
+		return err
+	}
+
+	fmt.Printf("Rows affected: %d \n", rowsAffected)
+
+	return nil
+}
+
+// CardsJSONPath is the card dump read when an import carries no upload.
+func CardsJSONPath() string {
+	return envOrDefault("CARDS_JSON_PATH", "cardinfo.json")
+}
+
+// BanlistJSONPath is the banlist dump of the given format read when an
+// import carries no upload: BANLIST_JSON_PATH for TCG, and for any other
+// format its own <FORMAT>_BANLIST_JSON_PATH, "banlistocg.json" style.
+func BanlistJSONPath(format string) string {
+	if format == "tcg" {
+		return envOrDefault("BANLIST_JSON_PATH", "banlist.json")
+	}
+
+	return envOrDefault(strings.ToUpper(format)+"_BANLIST_JSON_PATH", "banlist"+format+".json")
+}
+
+func envOrDefault(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	return fallback
+}
+
+// walkDataArray streams the top level "data" array of a YGOPRODeck dump and
+// calls decodeEntry once per element, so only one entry is held in memory at
+// a time no matter how large the file is.
+func walkDataArray(path string, decodeEntry func(dec *json.Decoder) error) error {
+	jsonFile, err := os.Open(path)
+	if checkErr(err) {
+		return err
+	}
+
+	defer jsonFile.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(jsonFile))
+
+	err = expectDelim(dec, '{')
+	if checkErr(err) {
+		return err
+	}
+
+	for dec.More() {
+		token, err := dec.Token()
+		if checkErr(err) {
+			return err
+		}
+
+		if key, _ := token.(string); key != "data" {
+			var skipped json.RawMessage
+			err = dec.Decode(&skipped)
+			if checkErr(err) {
+				return err
+			}
+			continue
+		}
+
+		err = expectDelim(dec, '[')
+		if checkErr(err) {
+			return err
+		}
+
+		for dec.More() {
+			err = decodeEntry(dec)
+			if checkErr(err) {
+				return err
+			}
+		}
+
+		err = expectDelim(dec, ']')
+		if checkErr(err) {
+			return err
+		}
+	}
+
+	return expectDelim(dec, '}')
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if checkErr(err) {
+		return err
+	}
+
+	if token != delim {
+		return fmt.Errorf("malformed JSON at offset %d: expected %q, got %v", dec.InputOffset(), delim, token)
+	}
+
+	return nil
+}
+
+// CardReader hands the cards of a card file to handle in batches of
+// importBatchSize and returns how many cards it read.
+type CardReader func(path string, handle func(cards []dbConfig.CardDB) error) (int, error)
+
+// streamCards is the CardReader of YGOPRODeck JSON dumps.
+func streamCards(path string, handle func(cards []dbConfig.CardDB) error) (int, error) {
+	count := 0
+	batch := []dbConfig.CardDB{}
+
+	err := walkDataArray(path, func(dec *json.Decoder) error {
+		var card dbConfig.CardDB
+
+		err := dec.Decode(&card)
+		if checkErr(err) {
+			return fmt.Errorf("card %d: %w", count+1, err)
+		}
+
+		count++
+		batch = append(batch, card)
+		if len(batch) < importBatchSize {
+			return nil
+		}
+
+		err = handle(batch)
+		batch = []dbConfig.CardDB{}
+
+		return err
+	})
+
+	if checkErr(err) {
+		return count, err
+	}
+
+	if len(batch) > 0 {
+		err = handle(batch)
+	}
+
+	return count, err
+}
+
+// BanlistReader hands the entries of a banlist file to handle one at a time
+// and returns how many it read. Each file format brings its own.
+type BanlistReader func(path string, handle func(banlist dbConfig.BanlistJSON) error) (int, error)
+
+// skipBanlistCards wraps read so the entries of the skipped cards never
+// reach handle.
+func skipBanlistCards(read BanlistReader, skip map[int]bool) BanlistReader {
+	return func(path string, handle func(banlist dbConfig.BanlistJSON) error) (int, error) {
+		return read(path, func(banlist dbConfig.BanlistJSON) error {
+			if skip[banlist.ID] {
+				return nil
+			}
+
+			return handle(banlist)
+		})
+	}
+}
+
+func streamBanlist(path string, handle func(banlist dbConfig.BanlistJSON) error) (int, error) {
+	count := 0
+
+	err := walkDataArray(path, func(dec *json.Decoder) error {
+		var banlist dbConfig.BanlistJSON
+
+		err := dec.Decode(&banlist)
+		if checkErr(err) {
+			return fmt.Errorf("banlist entry %d: %w", count+1, err)
+		}
+
+		count++
+
+		return handle(banlist)
+	})
+
+	return count, err
+}
+
+// LoadCardsJSON validates a card dump and, unless mode is "dryRun" or the
+// dump has invalid cards, writes it with a plain import or with "sync".
+func LoadCardsJSON(DB *sql.DB, path string, mode string, job *dbJobs.Job) (dbConfig.ImportResult, error) {
+	return loadCards(DB, path, mode, ValidateCardsJSON, streamCards, job)
+}
+
+// loadCards validates and writes a card file, whichever its format: validate
+// checks the whole file and read streams its cards.
+func loadCards(DB *sql.DB, path string, mode string,
+	validate func(path string) (dbConfig.ValidationReport, error), read CardReader, job *dbJobs.Job) (dbConfig.ImportResult, error) {
+	result := dbConfig.ImportResult{Mode: mode}
+
+	report, err := validate(path)
+	result.Validation = report
+	if checkErr(err) {
+		return result, err
+	}
+
+	job.SetTotal(report.Checked)
+
+	if report.Invalid > 0 {
+		for _, issue := range report.Issues {
+			job.AddError(issueError(issue))
+		}
+
+		return result, fmt.Errorf("%d of %d cards failed validation", report.Invalid, report.Checked)
+	}
+
+	switch mode {
+	case "dryRun":
+		return result, nil
+	case "sync":
+		summary, err := SyncCardsToDB(DB, path, read, job)
+		result.Sync = &summary
+
+		return result, err
+	case "merge":
+		// Only cards.cdb files are merged, see LoadCardsCDB
+		summary, err := MergeCardsToDB(DB, path, read, cdbColumns, job)
+		result.Sync = &summary
+
+		return result, err
+	}
+
+	return result, ExportCardsToDB(DB, path, read, job)
+}
+
+// LoadBanlistJSON works like LoadCardsJSON for the banlist version described
+// by version, which is created by the import if it does not exist yet.
+func LoadBanlistJSON(DB *sql.DB, version dbConfig.BanlistVersion, path string, mode string, job *dbJobs.Job) (dbConfig.ImportResult, error) {
+	return loadBanlist(DB, version, path, mode, ValidateBanlistJSON, streamBanlist, job)
+}
+
+// loadBanlist validates and writes a banlist file, whichever its format:
+// validate checks the whole file and read streams its entries.
+func loadBanlist(DB *sql.DB, version dbConfig.BanlistVersion, path string, mode string,
+	validate func(path string) (dbConfig.ValidationReport, error), read BanlistReader, job *dbJobs.Job) (dbConfig.ImportResult, error) {
+	result := dbConfig.ImportResult{Mode: mode}
+
+	report, err := validate(path)
+	result.Validation = report
+	if checkErr(err) {
+		return result, err
+	}
+
+	job.SetTotal(report.Checked)
+
+	if report.Invalid > 0 {
+		for _, issue := range report.Issues {
+			job.AddError(issueError(issue))
+		}
+
+		return result, fmt.Errorf("%d of %d banlist entries failed validation", report.Invalid, report.Checked)
+	}
+
+	// Lists from EDOPro and the like name cards that are not loaded here;
+	// those entries are skipped with a warning instead of failing the version
+	result.Skipped, err = unknownBanlistCards(DB, path, read)
+	if checkErr(err) {
+		return result, err
+	}
+
+	skip := map[int]bool{}
+	for _, issue := range result.Skipped {
+		job.AddError(issueError(issue))
+		skip[issue.ID] = true
+	}
+
+	// Skipped entries still count towards the total, so they are done now
+	job.Add(len(result.Skipped))
+
+	if len(skip) > 0 {
+		read = skipBanlistCards(read, skip)
+	}
+
+	switch mode {
+	case "dryRun":
+		return result, nil
+	case "sync":
+		summary, err := SyncBanlistToDB(DB, version, path, read, job)
+		result.Sync = &summary
+
+		return result, err
+	}
+
+	return result, ExportBanlistToDB(DB, version, path, read, job)
+}
+
+func ExportCardsToDB(DB *sql.DB, path string, read CardReader, job *dbJobs.Job) error {
+	tx, err := DB.Begin()
+	if checkErr(err) {
+		return err
+	}
+	defer tx.Rollback()
+
+	printingStaging, err := createPrintingStaging(tx)
+	if checkErr(err) {
+		return err
+	}
+
+	priceStaging, err := createPriceStaging(tx)
+	if checkErr(err) {
+		return err
+	}
+
+	tables := cardTables{
+		cards:     os.Getenv("CARD_TABLE_NAME"),
+		images:    os.Getenv("IMAGES_TABLE_NAME"),
+		printings: printingStaging,
+		prices:    priceStaging,
+	}
+
+	// add every card to the database, one COPY batch at a time
+	_, err = read(path, func(cards []dbConfig.CardDB) error {
+		err := copyCardsToDB(cards, tx, tables)
+		if checkErr(err) {
+			return err
+		}
+
+		job.Add(len(cards))
+
+		return nil
+	})
+
+	if checkErr(err) {
+		return err
+	}
+
+	_, err = mergePrintings(tx, printingStaging, "import")
+	if checkErr(err) {
+		return err
+	}
+
+	err = recordPrices(tx, priceStaging)
+	if checkErr(err) {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ExportBanlistToDB stores a banlist as a new dated version; importing a
+// version that already exists fails, a sync has to be used to refresh it.
+func ExportBanlistToDB(DB *sql.DB, version dbConfig.BanlistVersion, path string, read BanlistReader, job *dbJobs.Job) error {
+	tx, err := DB.Begin()
+	if checkErr(err) {
+		return err
+	}
+	defer tx.Rollback()
+
+	versionId, err := createBanlistVersion(tx, version)
+	if checkErr(err) {
+		return err
+	}
+
+	_, err = read(path, func(banlist dbConfig.BanlistJSON) error {
+		err := AddBanlistToDB(banlist, tx, version.Format, versionId)
+		if checkErr(err) {
+			return err
+		}
+
+		job.Add(1)
+
+		return nil
+	})
+
+	if checkErr(err) {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,136 @@
+package dbutils
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	dbConfig "Yu-Go-Oh-API/gopostgres/dbconfig"
+	dbJobs "Yu-Go-Oh-API/gopostgres/dbjobs"
+)
+
+// LflistPath is the lflist.conf read when an lflist import carries no upload.
+func LflistPath() string {
+	return envOrDefault("LFLIST_PATH", "lflist.conf")
+}
+
+// lflistReader reads the list named list out of an lflist.conf, or its first
+// list when list is empty. A file holds lists started by "!name" lines, each
+// followed by "<passcode> <copies> --comment" lines; "#" lines are comments.
+// The copy count a deck may hold, 0 to 3, indexes dbConfig.BanlistStatuses.
+// Entries come out with the status keyed by format, as in a JSON banlist.
+func lflistReader(list string, format string) BanlistReader {
+	return func(path string, handle func(banlist dbConfig.BanlistJSON) error) (int, error) {
+		confFile, err := os.Open(path)
+		if checkErr(err) {
+			return 0, err
+		}
+
+		defer confFile.Close()
+
+		count := 0
+		lineNumber := 0
+		found := false
+		reading := false
+
+		scanner := bufio.NewScanner(confFile)
+		for scanner.Scan() {
+			lineNumber++
+			line := strings.TrimSpace(scanner.Text())
+
+			switch {
+			case line == "" || strings.HasPrefix(line, "#"):
+				continue
+			case strings.HasPrefix(line, "!"):
+				name := strings.TrimSpace(line[1:])
+				reading = !found && (list == "" || name == list)
+				found = found || reading
+				continue
+			case !reading:
+				continue
+			case strings.HasPrefix(line, "$"):
+				// EDOPro "$whitelist" lists forbid every card they do not name,
+				// which a banlist version cannot express
+				return count, fmt.Errorf("lflist line %d: %q is not supported", lineNumber, line)
+			}
+
+			if comment := strings.Index(line, "--"); comment >= 0 {
+				line = line[:comment]
+			}
+
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				return count, fmt.Errorf("lflist line %d: expected a passcode and a copy count", lineNumber)
+			}
+
+			id, err := strconv.Atoi(fields[0])
+			if err != nil {
+				return count, fmt.Errorf("lflist line %d: invalid passcode %q", lineNumber, fields[0])
+			}
+
+			copies, err := strconv.Atoi(fields[1])
+			if err != nil || copies < 0 || copies >= len(dbConfig.BanlistStatuses) {
+				return count, fmt.Errorf("lflist line %d: invalid copy count %q", lineNumber, fields[1])
+			}
+
+			count++
+
+			err = handle(dbConfig.BanlistJSON{
+				ID:          id,
+				BanlistInfo: map[string]string{format: dbConfig.BanlistStatuses[copies]},
+			})
+			if checkErr(err) {
+				return count, err
+			}
+		}
+
+		if checkErr(scanner.Err()) {
+			return count, scanner.Err()
+		}
+
+		if !found && list != "" {
+			return count, fmt.Errorf("lflist has no list named %q", list)
+		}
+
+		return count, nil
+	}
+}
+
+// LoadBanlistLflist works like LoadBanlistJSON for an EDOPro/YGOPro
+// lflist.conf, importing the list named list or the first one of the file.
+func LoadBanlistLflist(DB *sql.DB, version dbConfig.BanlistVersion, path string, list string, mode string, job *dbJobs.Job) (dbConfig.ImportResult, error) {
+	read := lflistReader(list, version.Format)
+
+	return loadBanlist(DB, version, path, mode, validateBanlistFile(read), read, job)
+}
+
+// WriteLflist renders the cards of a banlist version as an lflist.conf that
+// EDOPro and YGOPro can read as is, grouped by status.
+func WriteLflist(version dbConfig.BanlistVersion, cards []dbConfig.Card) string {
+	var conf strings.Builder
+
+	fmt.Fprintf(&conf, "#[%s]\n", version.Name)
+	fmt.Fprintf(&conf, "!%s\n", version.Name)
+
+	for copies, status := range dbConfig.BanlistStatuses {
+		written := false
+
+		for _, card := range cards {
+			if card.BanlistInfo[version.Format] != status {
+				continue
+			}
+
+			if !written {
+				fmt.Fprintf(&conf, "#%s\n", strings.ToLower(status))
+				written = true
+			}
+
+			fmt.Fprintf(&conf, "%d %d --%s\n", card.ID, copies, card.Card_Name)
+		}
+	}
+
+	return conf.String()
+}
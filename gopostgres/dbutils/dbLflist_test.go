@@ -0,0 +1,160 @@
+package dbutils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	dbConfig "Yu-Go-Oh-API/gopostgres/dbconfig"
+)
+
+const lflistConf = `#[2023.02 TCG][2022.12 OCG]
+!2023.02 TCG
+#forbidden
+55144522 0 --Pot of Greed
+#limited
+14558127 1 --Ash Blossom & Joyous Spring
+# a comment between entries
+
+#semi-limited
+83764718 2 --Monster Reborn
+!2022.12 OCG
+55144522 0 --Pot of Greed
+83764718 1
+`
+
+// readLflist collects the statuses an lflist reader hands out, by passcode.
+func readLflist(t *testing.T, path string, list string) (map[int]string, int, error) {
+	statuses := map[int]string{}
+
+	count, err := lflistReader(list, "tcg")(path, func(banlist dbConfig.BanlistJSON) error {
+		if len(banlist.BanlistInfo) != 1 {
+			t.Errorf("entry %d has banlist_info %v, want only tcg", banlist.ID, banlist.BanlistInfo)
+		}
+
+		statuses[banlist.ID] = banlist.BanlistInfo["tcg"]
+
+		return nil
+	})
+
+	return statuses, count, err
+}
+
+func TestLflistReader(t *testing.T) {
+	path := writeTemp(t, "lflist.conf", lflistConf)
+
+	tests := []struct {
+		list     string
+		statuses map[int]string
+	}{
+		{"", map[int]string{55144522: "Forbidden", 14558127: "Limited", 83764718: "Semi-Limited"}},
+		{"2023.02 TCG", map[int]string{55144522: "Forbidden", 14558127: "Limited", 83764718: "Semi-Limited"}},
+		{"2022.12 OCG", map[int]string{55144522: "Forbidden", 83764718: "Limited"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.list, func(t *testing.T) {
+			statuses, count, err := readLflist(t, path, test.list)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if count != len(test.statuses) || !reflect.DeepEqual(statuses, test.statuses) {
+				t.Errorf("read %d entries %v, want %v", count, statuses, test.statuses)
+			}
+		})
+	}
+}
+
+func TestLflistReaderErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    string
+		list    string
+		message string
+	}{
+		{"whitelist", "!Edison\n$whitelist\n55144522 3\n", "", `line 2: "$whitelist" is not supported`},
+		{"missing copy count", "!Edison\n55144522 --Pot of Greed\n", "", "line 2: expected a passcode and a copy count"},
+		{"bad passcode", "!Edison\nPot 0\n", "", `line 2: invalid passcode "Pot"`},
+		{"too many copies", "!Edison\n55144522 4\n", "", `line 2: invalid copy count "4"`},
+		{"unknown list", lflistConf, "Goat", `no list named "Goat"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeTemp(t, "lflist.conf", test.conf)
+
+			_, _, err := readLflist(t, path, test.list)
+			if err == nil || !strings.Contains(err.Error(), test.message) {
+				t.Errorf("error = %v, want it to contain %q", err, test.message)
+			}
+		})
+	}
+}
+
+// A whitelist in a list that is not read does not stop the import.
+func TestLflistReaderSkipsOtherLists(t *testing.T) {
+	path := writeTemp(t, "lflist.conf", "!Edison\n$whitelist\n55144522 3\n!TCG\n55144522 0\n")
+
+	statuses, _, err := readLflist(t, path, "TCG")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(statuses, map[int]string{55144522: "Forbidden"}) {
+		t.Errorf("statuses = %v", statuses)
+	}
+}
+
+func TestWriteLflistRoundTrip(t *testing.T) {
+	version := dbConfig.BanlistVersion{Format: "tcg", Name: "TCG 2023-02-06"}
+	cards := []dbConfig.Card{
+		{ID: 14558127, Card_Name: "Ash Blossom & Joyous Spring", BanlistInfo: map[string]string{"tcg": "Limited"}},
+		{ID: 55144522, Card_Name: "Pot of Greed", BanlistInfo: map[string]string{"tcg": "Forbidden", "ocg": "Limited"}},
+		{ID: 83764718, Card_Name: "Monster Reborn", BanlistInfo: map[string]string{"tcg": "Semi-Limited"}},
+	}
+
+	conf := WriteLflist(version, cards)
+
+	want := `#[TCG 2023-02-06]
+!TCG 2023-02-06
+#forbidden
+55144522 0 --Pot of Greed
+#limited
+14558127 1 --Ash Blossom & Joyous Spring
+#semi-limited
+83764718 2 --Monster Reborn
+`
+	if conf != want {
+		t.Errorf("WriteLflist =\n%s\nwant\n%s", conf, want)
+	}
+
+	statuses, _, err := readLflist(t, writeTemp(t, "lflist.conf", conf), version.Name)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, card := range cards {
+		if statuses[card.ID] != card.BanlistInfo["tcg"] {
+			t.Errorf("card %d read back as %q, want %q", card.ID, statuses[card.ID], card.BanlistInfo["tcg"])
+		}
+	}
+}
+
+func TestSkipBanlistCards(t *testing.T) {
+	path := writeTemp(t, "lflist.conf", lflistConf)
+	read := skipBanlistCards(lflistReader("", "tcg"), map[int]bool{14558127: true})
+
+	ids := []int{}
+	_, err := read(path, func(banlist dbConfig.BanlistJSON) error {
+		ids = append(ids, banlist.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(ids, []int{55144522, 83764718}) {
+		t.Errorf("ids = %v, want [55144522 83764718]", ids)
+	}
+}
@@ -0,0 +1,98 @@
+package dbutils
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+
+	dbConfig "Yu-Go-Oh-API/gopostgres/dbconfig"
+)
+
+// Names scoring below this are not worth suggesting. It matches the default
+// pg_trgm.similarity_threshold the % operators filter on.
+const minNameSimilarity = 0.3
+
+// LookupCardName finds the card a possibly misspelled name refers to. Names
+// are compared the way card_name_normalize stores them, so case, accents,
+// hyphens and punctuation never matter. When no card has exactly that name
+// the closest one is returned as the match, and the next best as suggestions.
+// sql.ErrNoRows is returned when nothing comes close.
+func LookupCardName(DB *sql.DB, name string, limit int, banlistDate string) (dbConfig.NameLookup, error) {
+	lookup := dbConfig.NameLookup{Query: name, Suggestions: []dbConfig.NameSuggestion{}}
+
+	var exactId int
+	err := DB.QueryRow(fmt.Sprintf(`
+		SELECT id FROM %s
+		WHERE name_normalized = card_name_normalize($1)
+		ORDER BY id LIMIT 1`, os.Getenv("CARD_TABLE_NAME")), name).Scan(&exactId)
+
+	if err != nil && err != sql.ErrNoRows {
+		return lookup, err
+	}
+
+	suggestions, err := similarCardNames(DB, name, limit+1)
+	if checkErr(err) {
+		return lookup, err
+	}
+
+	matchId := exactId
+	if matchId == 0 {
+		if len(suggestions) == 0 {
+			return lookup, sql.ErrNoRows
+		}
+		matchId = suggestions[0].ID
+	}
+
+	for _, suggestion := range suggestions {
+		if suggestion.ID != matchId && len(lookup.Suggestions) < limit {
+			lookup.Suggestions = append(lookup.Suggestions, suggestion)
+		}
+	}
+
+	card, err := GetCardById(DB, matchId, banlistDate)
+	if checkErr(err) {
+		return lookup, err
+	}
+
+	lookup.Exact = exactId != 0
+	lookup.Match = &card
+
+	return lookup, nil
+}
+
+// similarCardNames ranks card names by trigram similarity to name. Word
+// similarity counts as well, so a fragment like "dark magi" still finds
+// Dark Magician despite the rest of the name missing.
+func similarCardNames(DB *sql.DB, name string, limit int) ([]dbConfig.NameSuggestion, error) {
+	sqlStatement := fmt.Sprintf(`
+		SELECT id, card_name, score
+		FROM %s
+		CROSS JOIN (SELECT card_name_normalize($1) as term) as T
+		CROSS JOIN LATERAL (
+			SELECT greatest(similarity(name_normalized, T.term), word_similarity(T.term, name_normalized)) as score
+		) as S
+		WHERE (name_normalized %% T.term OR T.term <%% name_normalized)
+			AND S.score >= $2
+		ORDER BY score DESC, length(card_name), id
+		LIMIT $3`, os.Getenv("CARD_TABLE_NAME"))
+
+	query, err := DB.Query(sqlStatement, name, minNameSimilarity, limit)
+	if checkErr(err) {
+		return nil, err
+	}
+	defer query.Close()
+
+	suggestions := []dbConfig.NameSuggestion{}
+	for query.Next() {
+		var suggestion dbConfig.NameSuggestion
+
+		err := query.Scan(&suggestion.ID, &suggestion.Card_Name, &suggestion.Similarity)
+		if checkErr(err) {
+			return nil, err
+		}
+
+		suggestions = append(suggestions, suggestion)
+	}
+
+	return suggestions, query.Err()
+}
@@ -0,0 +1,120 @@
+package dbutils
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	dbConfig "Yu-Go-Oh-API/gopostgres/dbconfig"
+)
+
+var priceStagingColumns = []string{"card_id", "vendor", "price"}
+
+// createPriceStaging holds the card_prices of an import until the cards they
+// belong to are written.
+func createPriceStaging(tx *sql.Tx) (string, error) {
+	staging := os.Getenv("PRICES_TABLE_NAME") + "_staging"
+	sqlStatement := fmt.Sprintf(`
+		CREATE TEMP TABLE %s (
+			card_id integer NOT NULL,
+			vendor text NOT NULL,
+			price numeric(12, 2) NOT NULL
+		) ON COMMIT DROP`, staging)
+
+	_, err := tx.Exec(sqlStatement)
+
+	return staging, err
+}
+
+// cardPriceRows flattens the card_prices block of a card, whose keys look like
+// "tcgplayer_price", into one row per known vendor with a numeric price.
+func cardPriceRows(card dbConfig.CardDB) [][]interface{} {
+	rows := [][]interface{}{}
+
+	for _, prices := range card.Prices {
+		for key, price := range prices {
+			vendor := strings.TrimSuffix(key, "_price")
+			if !contains(dbConfig.PriceVendors, vendor) {
+				continue
+			}
+
+			if _, err := strconv.ParseFloat(price, 64); err != nil {
+				continue
+			}
+
+			rows = append(rows, []interface{}{card.ID, vendor, price})
+		}
+	}
+
+	return rows
+}
+
+// recordPrices appends the staged prices as one snapshot dated at the start
+// of the import transaction, so every import adds to the price history.
+func recordPrices(tx *sql.Tx, staging string) error {
+	sqlStatement := fmt.Sprintf(`
+		INSERT INTO %s (card_id, vendor, price, recorded_at)
+		SELECT DISTINCT ON (p.card_id, p.vendor) p.card_id, p.vendor, p.price, now()
+		FROM %s p
+		JOIN %s c ON c.id = p.card_id
+		ORDER BY p.card_id, p.vendor
+		ON CONFLICT (card_id, vendor, recorded_at) DO NOTHING`,
+		os.Getenv("PRICES_TABLE_NAME"), staging, os.Getenv("CARD_TABLE_NAME"))
+
+	_, err := tx.Exec(sqlStatement)
+
+	return err
+}
+
+// GetCardPrices returns the latest price of every vendor for a card along
+// with each vendor's full history, oldest first.
+func GetCardPrices(DB *sql.DB, id int) (dbConfig.CardPrices, error) {
+	prices := dbConfig.CardPrices{
+		Card_id: id,
+		Current: map[string]dbConfig.PricePoint{},
+		History: map[string][]dbConfig.PricePoint{},
+	}
+
+	sqlStatement := fmt.Sprintf(`
+		SELECT vendor, price::text, recorded_at
+		FROM %s
+		WHERE card_id = $1
+		ORDER BY vendor, recorded_at`, os.Getenv("PRICES_TABLE_NAME"))
+
+	query, err := DB.Query(sqlStatement, id)
+	if checkErr(err) {
+		return prices, err
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var vendor string
+		var point dbConfig.PricePoint
+
+		err = query.Scan(&vendor, &point.Price, &point.Recorded_at)
+		if checkErr(err) {
+			return prices, err
+		}
+
+		prices.History[vendor] = append(prices.History[vendor], point)
+		prices.Current[vendor] = point
+	}
+
+	return prices, query.Err()
+}
+
+// latestPriceFilter matches cards whose most recent price at vendor satisfies
+// the comparison.
+func latestPriceFilter(q *queryBuilder, vendor string, operator string, price float64) string {
+	return fmt.Sprintf(`id IN (
+		SELECT lp.card_id FROM (
+			SELECT DISTINCT ON (card_id) card_id, price
+			FROM %s
+			WHERE vendor = %s
+			ORDER BY card_id, recorded_at DESC
+		) as lp
+		WHERE lp.price %s %s
+	)`, os.Getenv("PRICES_TABLE_NAME"), q.arg(vendor), operator, q.arg(price))
+}
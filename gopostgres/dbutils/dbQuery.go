@@ -0,0 +1,457 @@
+package dbutils
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	dbConfig "Yu-Go-Oh-API/gopostgres/dbconfig"
+
+	pq "github.com/lib/pq"
+)
+
+// queryBuilder collects the conditions of a card query. Values never become
+// part of the SQL text: arg hands out a $n placeholder for each of them.
+type queryBuilder struct {
+	conditions []string
+	args       []interface{}
+}
+
+func (q *queryBuilder) arg(value interface{}) string {
+	q.args = append(q.args, value)
+
+	return fmt.Sprintf("$%d", len(q.args))
+}
+
+func (q *queryBuilder) where(condition string) {
+	q.conditions = append(q.conditions, condition)
+}
+
+// whereClause joins the conditions with AND, each in parentheses so an OR
+// inside one of them stays inside it.
+func (q *queryBuilder) whereClause() string {
+	if len(q.conditions) == 0 {
+		return ""
+	}
+
+	return "WHERE (" + strings.Join(q.conditions, ") AND (") + ")"
+}
+
+// cardFilter says which column a filter parameter reads and how it matches:
+//   - "exact" and "prefix" compare text, the latter case insensitively
+//   - "int", "bool" and "date" parse the value before comparing; "range"
+//     is an int filter with a comparison suffix, see rangeColumns
+//   - "array" needs every comma separated value in a text[] column
+//   - "name" matches the name or the description
+//   - "printing" and "price" look at the printings and prices tables
+type cardFilter struct {
+	column string
+	match  string
+}
+
+// cardFilters whitelists the parameters of /cards/filter/; no other key of a
+// filter map reaches the SQL, apart from the <format>_status banlist filters
+// whose format is passed as a value.
+var cardFilters = map[string]cardFilter{
+	"card_name":   {"card_name", "name"},
+	"card_type":   {"card_type", "exact"},
+	"frame_type":  {"frame_type", "exact"},
+	"archetype":   {"archetype", "prefix"},
+	"attribute":   {"attr", "prefix"},
+	"race":        {"race", "prefix"},
+	"card_level":  {"card_level", "int"},
+	"linkval":     {"linkval", "int"},
+	"card_scale":  {"card_scale", "int"},
+	"atk":         {"atk", "int"},
+	"def":         {"def", "int"},
+	"konami_id":   {"konami_id", "int"},
+	"has_effect":  {"has_effect", "bool"},
+	"tcg_date":    {"tcg_date", "date"},
+	"ocg_date":    {"ocg_date", "date"},
+	"linkmarkers": {"linkmarkers", "array"},
+	"formats":     {"formats", "array"},
+	"typeline":    {"typeline", "array"},
+	"set_code":    {"set_code", "printing"},
+	"rarity":      {"set_rarity", "printing"},
+	"min_price":   {"price", "price"},
+	"max_price":   {"price", "price"},
+}
+
+// rangeColumns are the numeric filters that also take a comparison suffix:
+// atk_gte=1800, def_lt=1000 or card_level_between=4,6.
+var rangeColumns = []string{"atk", "def", "card_level", "linkval", "card_scale"}
+
+var rangeOperators = map[string]string{
+	"_gt":      ">",
+	"_gte":     ">=",
+	"_lt":      "<",
+	"_lte":     "<=",
+	"_between": "BETWEEN",
+}
+
+// RangeFilterKeys lists every parameter rangeColumns and rangeOperators make.
+func RangeFilterKeys() []string {
+	keys := []string{}
+	for _, column := range rangeColumns {
+		for suffix := range rangeOperators {
+			keys = append(keys, column+suffix)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// listFilters take a comma separated list of values, any of which matches,
+// and are negated by a leading "!" or a not_ prefix: race=!Dragon,Wyrm is
+// not_race=Dragon,Wyrm. A negated filter also matches cards without the
+// column at all, like spells for attribute.
+var listFilters = []string{"attribute", "race", "card_type", "archetype", "card_level"}
+
+// NegatedFilterKeys lists the not_ parameters of listFilters.
+func NegatedFilterKeys() []string {
+	keys := []string{}
+	for _, key := range listFilters {
+		keys = append(keys, "not_"+key)
+	}
+
+	return keys
+}
+
+// rangeFilter splits a key like atk_gte into its filter and operator.
+func rangeFilter(key string) (string, string, bool) {
+	for _, column := range rangeColumns {
+		for suffix, operator := range rangeOperators {
+			if key == column+suffix {
+				return column, operator, true
+			}
+		}
+	}
+
+	return "", "", false
+}
+
+// Parameters that shape the results without filtering by themselves; they
+// are carried over to the pagination urls.
+var filterOptions = []string{"price_vendor", "banlist_date", "sort"}
+
+// sortColumns whitelists what the sort parameter, like
+// sort=atk:desc,card_name:asc, may order by.
+var sortColumns = map[string]string{
+	"id":         "id",
+	"card_name":  "card_name",
+	"card_type":  "card_type",
+	"archetype":  "archetype",
+	"attribute":  "attr",
+	"race":       "race",
+	"atk":        "atk",
+	"def":        "def",
+	"card_level": "card_level",
+	"linkval":    "linkval",
+	"card_scale": "card_scale",
+	"konami_id":  "konami_id",
+	"tcg_date":   "tcg_date",
+	"ocg_date":   "ocg_date",
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// FilterError is a filter parameter whose value does not parse, like
+// atk=high: the request is wrong, not the query.
+type FilterError struct {
+	Key      string
+	Value    string
+	Expected string
+}
+
+func (err *FilterError) Error() string {
+	if err.Value == "" {
+		return fmt.Sprintf("invalid %s, expected %s", err.Key, err.Expected)
+	}
+
+	return fmt.Sprintf("invalid %s %q, expected %s", err.Key, err.Value, err.Expected)
+}
+
+// applyCardFilters adds a condition per non empty filter of filterMap and
+// returns the query string that repeats them. Values that do not parse as
+// their column's type are a FilterError rather than a SQL failure.
+func applyCardFilters(q *queryBuilder, filterMap map[string]string) (string, error) {
+	params := url.Values{}
+
+	keys := []string{}
+	for key := range filterMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	printing := false
+	for _, key := range keys {
+		value := filterMap[key]
+		filter, ok := cardFilters[key]
+
+		operator := ""
+		if base, rangeOperator, isRange := rangeFilter(key); isRange {
+			filter = cardFilters[base]
+			filter.match = "range"
+			operator = rangeOperator
+			ok = true
+		}
+
+		negate := false
+		if base := strings.TrimPrefix(key, "not_"); base != key && contains(listFilters, base) {
+			filter = cardFilters[base]
+			negate = true
+			ok = true
+		}
+
+		if format, isStatus := BanlistStatusKey(key); isStatus && value != "" {
+			params.Set(key, value)
+
+			condition, err := banlistStatusFilter(q, key, format, value, filterMap["banlist_date"])
+			if checkErr(err) {
+				return "", err
+			}
+
+			q.where(condition)
+			continue
+		}
+
+		if !ok || value == "" {
+			continue
+		}
+
+		params.Set(key, value)
+
+		if contains(listFilters, strings.TrimPrefix(key, "not_")) {
+			if strings.HasPrefix(value, "!") {
+				negate = !negate
+				value = value[1:]
+			}
+
+			condition, err := listFilter(q, key, filter, splitList(value), negate)
+			if checkErr(err) {
+				return "", err
+			}
+
+			q.where(condition)
+			continue
+		}
+
+		switch filter.match {
+		case "exact":
+			q.where(fmt.Sprintf("%s = %s", filter.column, q.arg(value)))
+		case "prefix":
+			q.where(fmt.Sprintf("%s ILIKE %s", filter.column, q.arg(likeEscaper.Replace(value)+"%")))
+		case "int":
+			if value == "?" && (filter.column == "atk" || filter.column == "def") {
+				q.where(unknownStatFilter(filter.column))
+				break
+			}
+
+			integer, err := strconv.Atoi(value)
+			if err != nil {
+				return "", &FilterError{key, value, "a number"}
+			}
+
+			q.where(fmt.Sprintf("%s = %s", filter.column, q.arg(integer)))
+		case "range":
+			// Comparisons never match NULL, so "?" ATK/DEF and cards without
+			// the stat at all fall out of every range
+			if operator == "BETWEEN" {
+				bounds := splitList(value)
+				if len(bounds) != 2 {
+					return "", &FilterError{key, value, "two numbers like 4,6"}
+				}
+
+				low, lowErr := strconv.Atoi(bounds[0])
+				high, highErr := strconv.Atoi(bounds[1])
+				if lowErr != nil || highErr != nil {
+					return "", &FilterError{key, value, "two numbers like 4,6"}
+				}
+
+				q.where(fmt.Sprintf("%s BETWEEN %s AND %s", filter.column, q.arg(low), q.arg(high)))
+				break
+			}
+
+			integer, err := strconv.Atoi(value)
+			if err != nil {
+				return "", &FilterError{key, value, "a number"}
+			}
+
+			q.where(fmt.Sprintf("%s %s %s", filter.column, operator, q.arg(integer)))
+		case "bool":
+			boolean, err := strconv.ParseBool(value)
+			if err != nil {
+				return "", &FilterError{key, value, "true or false"}
+			}
+
+			q.where(fmt.Sprintf("%s = %s", filter.column, q.arg(boolean)))
+		case "date":
+			if _, err := time.Parse(dateLayout, value); err != nil {
+				return "", &FilterError{key, value, "YYYY-MM-DD"}
+			}
+
+			q.where(fmt.Sprintf("%s = %s::date", filter.column, q.arg(value)))
+		case "array":
+			q.where(fmt.Sprintf("%s @> %s::text[]", filter.column, q.arg(pq.StringArray(splitList(value)))))
+		case "name":
+			pattern := q.arg(likeEscaper.Replace(strings.ReplaceAll(value, `"`, "")) + "%")
+			q.where(fmt.Sprintf("card_name ILIKE %[1]s OR description ILIKE %[1]s", pattern))
+		case "printing":
+			// set_code and rarity have to match the same printing, so both go
+			// into one subquery, written when the first of them comes up
+			if !printing {
+				q.where(printingFilter(q, filterMap["set_code"], filterMap["rarity"]))
+				printing = true
+			}
+		case "price":
+			price, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return "", &FilterError{key, value, "a price"}
+			}
+
+			vendor := filterMap["price_vendor"]
+			if !contains(dbConfig.PriceVendors, vendor) {
+				vendor = "tcgplayer"
+			}
+
+			operator := ">="
+			if key == "max_price" {
+				operator = "<="
+			}
+
+			q.where(latestPriceFilter(q, vendor, operator, price))
+		}
+	}
+
+	for _, option := range filterOptions {
+		if filterMap[option] != "" {
+			params.Set(option, filterMap[option])
+		}
+	}
+
+	return params.Encode(), nil
+}
+
+// listFilter matches any of values the way filter matches one, or none of
+// them when negate is set.
+func listFilter(q *queryBuilder, key string, filter cardFilter, values []string, negate bool) (string, error) {
+	if len(values) == 0 {
+		return "", &FilterError{key, "", "at least one value"}
+	}
+
+	var condition string
+
+	switch filter.match {
+	case "prefix":
+		patterns := []string{}
+		for _, value := range values {
+			patterns = append(patterns, likeEscaper.Replace(value)+"%")
+		}
+
+		condition = fmt.Sprintf("%s ILIKE ANY(%s::text[])", filter.column, q.arg(pq.StringArray(patterns)))
+	case "exact":
+		condition = fmt.Sprintf("%s = ANY(%s::text[])", filter.column, q.arg(pq.StringArray(values)))
+	case "int":
+		integers := []int64{}
+		for _, value := range values {
+			integer, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return "", &FilterError{key, value, "numbers"}
+			}
+
+			integers = append(integers, integer)
+		}
+
+		condition = fmt.Sprintf("%s = ANY(%s::int[])", filter.column, q.arg(pq.Int64Array(integers)))
+	}
+
+	if negate {
+		condition = fmt.Sprintf("%s IS NULL OR NOT (%s)", filter.column, condition)
+	}
+
+	return condition, nil
+}
+
+// unknownStatFilter matches monsters whose ATK or DEF is "?", stored as
+// NULL like the missing stats of spells, traps and, for DEF, Link monsters.
+func unknownStatFilter(column string) string {
+	condition := fmt.Sprintf("%s IS NULL AND card_type LIKE '%%Monster%%'", column)
+	if column == "def" {
+		condition = condition + " AND card_type <> 'Link Monster'"
+	}
+
+	return condition
+}
+
+// printingFilter matches cards with a printing in a set whose code starts
+// with setCode and, if given, of the rarity named or coded by rarity.
+func printingFilter(q *queryBuilder, setCode string, rarity string) string {
+	conditions := []string{}
+
+	if setCode != "" {
+		conditions = append(conditions, fmt.Sprintf("p.set_code ILIKE %s", q.arg(likeEscaper.Replace(setCode)+"%")))
+	}
+
+	if rarity != "" {
+		placeholder := q.arg(likeEscaper.Replace(rarity))
+		conditions = append(conditions, fmt.Sprintf(
+			"(p.set_rarity ILIKE %[1]s OR trim(both '()' from p.set_rarity_code) ILIKE %[1]s)", placeholder))
+	}
+
+	return fmt.Sprintf("id IN (SELECT p.card_id FROM %s p WHERE %s)",
+		os.Getenv("SET_PRINTINGS_TABLE_NAME"), strings.Join(conditions, " AND "))
+}
+
+// orderBy turns a sort parameter into an ORDER BY on the columns of alias.
+// Cards without the column come last either way, and id breaks every tie so
+// pages never overlap or skip a card.
+func orderBy(sort string, alias string) (string, error) {
+	terms := []string{}
+	sortsById := false
+
+	for _, field := range splitList(sort) {
+		name, direction, _ := strings.Cut(field, ":")
+
+		column, ok := sortColumns[name]
+		if !ok {
+			return "", &FilterError{"sort", sort, "a sortable column, not " + name}
+		}
+
+		switch strings.ToLower(direction) {
+		case "", "asc":
+			direction = "ASC"
+		case "desc":
+			direction = "DESC"
+		default:
+			return "", &FilterError{"sort", sort, "asc or desc, not " + direction}
+		}
+
+		terms = append(terms, fmt.Sprintf("%s.%s %s NULLS LAST", alias, column, direction))
+		sortsById = sortsById || column == "id"
+	}
+
+	if !sortsById {
+		terms = append(terms, alias+".id ASC")
+	}
+
+	return "ORDER BY " + strings.Join(terms, ", "), nil
+}
+
+// splitList reads a comma separated parameter, dropping the quotes people
+// put around values like "Top","Bottom".
+func splitList(value string) []string {
+	values := []string{}
+	for _, val := range strings.Split(value, ",") {
+		val = strings.Trim(strings.TrimSpace(val), `"'`)
+		if val != "" {
+			values = append(values, val)
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,436 @@
+package dbutils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	pq "github.com/lib/pq"
+)
+
+// The q parameter of /cards/filter/ is a small query language:
+//
+//	attribute:DARK (race:Dragon OR race:Wyrm) atk>=2500 -archetype:"Blue-Eyes" text:"banish"
+//
+// Terms next to each other must all match, OR between them needs either, and
+// AND binds tighter than OR. Parentheses group terms, and a leading - or NOT
+// negates one. A term is a field, an operator and a value, or a bare word
+// looked for in card names. Quotes keep spaces and punctuation in a value.
+
+// QueryError is a syntax or value error in a q parameter. Position counts
+// characters from 1, pointing at where the query stopped making sense.
+type QueryError struct {
+	Position int
+	Message  string
+}
+
+func (err *QueryError) Error() string {
+	return fmt.Sprintf("invalid q at position %d: %s", err.Position, err.Message)
+}
+
+// queryFields whitelists the fields of the query language. Most match like
+// their /cards/filter/ parameter; name and text look for the value anywhere
+// in the card name or its effect.
+var queryFields = map[string]cardFilter{
+	"name":        {"card_name", "contains"},
+	"text":        {"description", "contains"},
+	"card_type":   cardFilters["card_type"],
+	"type":        cardFilters["card_type"],
+	"frame_type":  cardFilters["frame_type"],
+	"archetype":   cardFilters["archetype"],
+	"attribute":   cardFilters["attribute"],
+	"attr":        cardFilters["attribute"],
+	"race":        cardFilters["race"],
+	"card_level":  cardFilters["card_level"],
+	"level":       cardFilters["card_level"],
+	"linkval":     cardFilters["linkval"],
+	"link":        cardFilters["linkval"],
+	"card_scale":  cardFilters["card_scale"],
+	"scale":       cardFilters["card_scale"],
+	"atk":         cardFilters["atk"],
+	"def":         cardFilters["def"],
+	"konami_id":   cardFilters["konami_id"],
+	"has_effect":  cardFilters["has_effect"],
+	"tcg_date":    cardFilters["tcg_date"],
+	"ocg_date":    cardFilters["ocg_date"],
+	"linkmarkers": cardFilters["linkmarkers"],
+	"formats":     cardFilters["formats"],
+	"typeline":    cardFilters["typeline"],
+	"set_code":    cardFilters["set_code"],
+	"set":         cardFilters["set_code"],
+	"rarity":      cardFilters["rarity"],
+}
+
+const (
+	tokenWord = iota
+	tokenString
+	tokenOperator
+	tokenOpen
+	tokenClose
+	tokenNot
+	tokenEnd
+)
+
+type queryToken struct {
+	kind     int
+	text     string
+	position int
+}
+
+// lexQuery splits a query into tokens. A - only negates at the start of a
+// term; inside a word like Blue-Eyes it is part of it.
+func lexQuery(text string) ([]queryToken, error) {
+	runes := []rune(text)
+	tokens := []queryToken{}
+
+	isOperator := func(r rune) bool {
+		return r == ':' || r == '=' || r == '<' || r == '>'
+	}
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		position := i + 1
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, queryToken{tokenOpen, "(", position})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{tokenClose, ")", position})
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+
+			if end == len(runes) {
+				return nil, &QueryError{position, "unterminated quote"}
+			}
+
+			tokens = append(tokens, queryToken{tokenString, string(runes[i+1 : end]), position})
+			i = end + 1
+		case isOperator(r):
+			operator := string(r)
+			if i+1 < len(runes) && runes[i+1] == '=' && (r == '<' || r == '>') {
+				operator = operator + "="
+			}
+
+			tokens = append(tokens, queryToken{tokenOperator, operator, position})
+			i += len(operator)
+		case r == '-' && (len(tokens) == 0 || tokens[len(tokens)-1].kind != tokenOperator):
+			tokens = append(tokens, queryToken{tokenNot, "-", position})
+			i++
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && !isOperator(runes[end]) &&
+				runes[end] != '(' && runes[end] != ')' && runes[end] != '"' {
+				end++
+			}
+
+			word := string(runes[i:end])
+			kind := tokenWord
+			if word == "NOT" {
+				kind = tokenNot
+			}
+
+			tokens = append(tokens, queryToken{kind, word, position})
+			i = end
+		}
+	}
+
+	return append(tokens, queryToken{tokenEnd, "", len(runes) + 1}), nil
+}
+
+// queryNode is a node of a parsed query: queryAnd, queryOr, queryNot or
+// queryTerm.
+type queryNode interface {
+	sql(q *queryBuilder) (string, error)
+}
+
+type queryAnd []queryNode
+
+type queryOr []queryNode
+
+type queryNot struct {
+	node queryNode
+}
+
+// Positions of a term point at its field and at its value, for errors about
+// either.
+type queryTerm struct {
+	field         string
+	operator      string
+	value         string
+	fieldPosition int
+	position      int
+}
+
+type queryParser struct {
+	tokens []queryToken
+	next   int
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.next]
+}
+
+func (p *queryParser) take() queryToken {
+	token := p.tokens[p.next]
+	if token.kind != tokenEnd {
+		p.next++
+	}
+
+	return token
+}
+
+// parseQuery reads a whole q parameter into its tree.
+func parseQuery(text string) (queryNode, error) {
+	tokens, err := lexQuery(text)
+	if checkErr(err) {
+		return nil, err
+	}
+
+	p := &queryParser{tokens: tokens}
+	if p.peek().kind == tokenEnd {
+		return nil, &QueryError{1, "the query is empty"}
+	}
+
+	node, err := p.parseOr()
+	if checkErr(err) {
+		return nil, err
+	}
+
+	if token := p.peek(); token.kind != tokenEnd {
+		return nil, &QueryError{token.position, fmt.Sprintf("unexpected %q", token.text)}
+	}
+
+	return node, nil
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	node, err := p.parseAnd()
+	if checkErr(err) {
+		return nil, err
+	}
+
+	nodes := queryOr{node}
+	for p.peek().kind == tokenWord && p.peek().text == "OR" {
+		p.take()
+
+		node, err := p.parseAnd()
+		if checkErr(err) {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+
+	return nodes, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	nodes := queryAnd{}
+
+	for {
+		token := p.peek()
+
+		if token.kind == tokenWord && token.text == "AND" {
+			if len(nodes) == 0 {
+				return nil, &QueryError{token.position, "AND needs a term before it"}
+			}
+			p.take()
+		} else if token.kind == tokenEnd || token.kind == tokenClose || (token.kind == tokenWord && token.text == "OR") {
+			break
+		}
+
+		node, err := p.parseUnary()
+		if checkErr(err) {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+
+	if len(nodes) == 0 {
+		token := p.peek()
+		if token.kind == tokenEnd {
+			return nil, &QueryError{token.position, "expected a term at the end of the query"}
+		}
+
+		return nil, &QueryError{token.position, fmt.Sprintf("expected a term before %q", token.text)}
+	}
+
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+
+	return nodes, nil
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	token := p.take()
+
+	switch token.kind {
+	case tokenNot:
+		node, err := p.parseUnary()
+		if checkErr(err) {
+			return nil, err
+		}
+
+		return queryNot{node}, nil
+	case tokenOpen:
+		node, err := p.parseOr()
+		if checkErr(err) {
+			return nil, err
+		}
+
+		if closing := p.take(); closing.kind != tokenClose {
+			return nil, &QueryError{closing.position, fmt.Sprintf("expected ) to close the ( at position %d", token.position)}
+		}
+
+		return node, nil
+	case tokenWord, tokenString:
+		if token.kind == tokenWord && (token.text == "OR" || token.text == "AND") {
+			return nil, &QueryError{token.position, fmt.Sprintf("expected a term before %q", token.text)}
+		}
+
+		if p.peek().kind != tokenOperator {
+			return queryTerm{"name", ":", token.text, token.position, token.position}, nil
+		}
+
+		if token.kind == tokenString {
+			return nil, &QueryError{token.position, "a field name cannot be quoted"}
+		}
+
+		operator := p.take()
+		value := p.take()
+		if value.kind != tokenWord && value.kind != tokenString {
+			return nil, &QueryError{value.position, fmt.Sprintf("expected a value after %s%s", token.text, operator.text)}
+		}
+
+		return queryTerm{strings.ToLower(token.text), operator.text, value.text, token.position, value.position}, nil
+	case tokenEnd:
+		return nil, &QueryError{token.position, "expected a term at the end of the query"}
+	}
+
+	return nil, &QueryError{token.position, fmt.Sprintf("unexpected %q", token.text)}
+}
+
+func (node queryAnd) sql(q *queryBuilder) (string, error) {
+	return joinQueryNodes(q, []queryNode(node), " AND ")
+}
+
+func (node queryOr) sql(q *queryBuilder) (string, error) {
+	return joinQueryNodes(q, []queryNode(node), " OR ")
+}
+
+func joinQueryNodes(q *queryBuilder, nodes []queryNode, operator string) (string, error) {
+	conditions := []string{}
+	for _, node := range nodes {
+		condition, err := node.sql(q)
+		if checkErr(err) {
+			return "", err
+		}
+
+		conditions = append(conditions, "("+condition+")")
+	}
+
+	return strings.Join(conditions, operator), nil
+}
+
+// A negated term also matches cards without the column at all, so
+// -archetype:"Blue-Eyes" keeps the cards with no archetype.
+func (node queryNot) sql(q *queryBuilder) (string, error) {
+	condition, err := node.node.sql(q)
+	if checkErr(err) {
+		return "", err
+	}
+
+	return fmt.Sprintf("NOT coalesce((%s), false)", condition), nil
+}
+
+func (term queryTerm) sql(q *queryBuilder) (string, error) {
+	filter, ok := queryFields[term.field]
+	if !ok {
+		return "", &QueryError{term.fieldPosition, fmt.Sprintf("unknown field %q", term.field)}
+	}
+
+	// Comparisons only make sense on numbers and dates; every field takes : and =
+	operator := term.operator
+	if operator == ":" {
+		operator = "="
+	}
+
+	if operator != "=" && filter.match != "int" && filter.match != "date" {
+		return "", &QueryError{term.fieldPosition, fmt.Sprintf("%s cannot be compared with %s", term.field, term.operator)}
+	}
+
+	value := term.value
+
+	switch filter.match {
+	case "contains":
+		return fmt.Sprintf("%s ILIKE %s", filter.column, q.arg("%"+likeEscaper.Replace(value)+"%")), nil
+	case "exact":
+		return fmt.Sprintf("%s = %s", filter.column, q.arg(value)), nil
+	case "prefix":
+		return fmt.Sprintf("%s ILIKE %s", filter.column, q.arg(likeEscaper.Replace(value)+"%")), nil
+	case "int":
+		if value == "?" && operator == "=" && (filter.column == "atk" || filter.column == "def") {
+			return unknownStatFilter(filter.column), nil
+		}
+
+		integer, err := strconv.Atoi(value)
+		if err != nil {
+			return "", &QueryError{term.position, fmt.Sprintf("%s needs a number, not %q", term.field, value)}
+		}
+
+		return fmt.Sprintf("%s %s %s", filter.column, operator, q.arg(integer)), nil
+	case "bool":
+		boolean, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", &QueryError{term.position, fmt.Sprintf("%s needs true or false, not %q", term.field, value)}
+		}
+
+		return fmt.Sprintf("%s = %s", filter.column, q.arg(boolean)), nil
+	case "date":
+		if _, err := time.Parse(dateLayout, value); err != nil {
+			return "", &QueryError{term.position, fmt.Sprintf("%s needs a YYYY-MM-DD date, not %q", term.field, value)}
+		}
+
+		return fmt.Sprintf("%s %s %s::date", filter.column, operator, q.arg(value)), nil
+	case "array":
+		return fmt.Sprintf("%s @> %s::text[]", filter.column, q.arg(pq.StringArray(splitList(value)))), nil
+	case "printing":
+		if filter.column == "set_code" {
+			return printingFilter(q, value, ""), nil
+		}
+
+		return printingFilter(q, "", value), nil
+	}
+
+	return "", &QueryError{term.fieldPosition, fmt.Sprintf("unknown field %q", term.field)}
+}
+
+// queryFilter parses a q parameter and adds it to q as one condition.
+func queryFilter(q *queryBuilder, text string) error {
+	node, err := parseQuery(text)
+	if checkErr(err) {
+		return err
+	}
+
+	condition, err := node.sql(q)
+	if checkErr(err) {
+		return err
+	}
+
+	q.where(condition)
+
+	return nil
+}
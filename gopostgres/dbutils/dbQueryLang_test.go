@@ -0,0 +1,141 @@
+package dbutils
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLexQuery(t *testing.T) {
+	tokens, err := lexQuery(`-archetype:"Blue-Eyes" atk>=2500 Blue-Eyes`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []queryToken{
+		{tokenNot, "-", 1},
+		{tokenWord, "archetype", 2},
+		{tokenOperator, ":", 11},
+		{tokenString, "Blue-Eyes", 12},
+		{tokenWord, "atk", 24},
+		{tokenOperator, ">=", 27},
+		{tokenWord, "2500", 29},
+		{tokenWord, "Blue-Eyes", 34},
+		{tokenEnd, "", 43},
+	}
+
+	if !reflect.DeepEqual(tokens, want) {
+		t.Errorf("tokens = %v, want %v", tokens, want)
+	}
+}
+
+func TestQueryFilter(t *testing.T) {
+	tests := []struct {
+		query     string
+		condition string
+		args      []interface{}
+	}{
+		{
+			query: `attribute:DARK (race:Dragon OR race:Wyrm) atk>=2500 -archetype:"Blue-Eyes" text:"banish"`,
+			condition: "(attr ILIKE $1) AND ((race ILIKE $2) OR (race ILIKE $3)) AND (atk >= $4)" +
+				" AND (NOT coalesce((archetype ILIKE $5), false)) AND (description ILIKE $6)",
+			args: []interface{}{"DARK%", "Dragon%", "Wyrm%", 2500, "Blue-Eyes%", "%banish%"},
+		},
+		{
+			query:     `atk:? OR def<=0 AND level:4`,
+			condition: "(atk IS NULL AND card_type LIKE '%Monster%') OR ((def <= $1) AND (card_level = $2))",
+			args:      []interface{}{0, 4},
+		},
+		{
+			query:     `dark magician`,
+			condition: "(card_name ILIKE $1) AND (card_name ILIKE $2)",
+			args:      []interface{}{"%dark%", "%magician%"},
+		},
+		{
+			query:     `NOT tcg_date>2020-01-01`,
+			condition: "NOT coalesce((tcg_date > $1::date), false)",
+			args:      []interface{}{"2020-01-01"},
+		},
+		{
+			query:     `name:"100% Effort"`,
+			condition: "card_name ILIKE $1",
+			args:      []interface{}{`%100\% Effort%`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			q := &queryBuilder{}
+
+			if err := queryFilter(q, test.query); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if len(q.conditions) != 1 || q.conditions[0] != test.condition {
+				t.Errorf("conditions = %q, want %q", q.conditions, test.condition)
+			}
+
+			if !reflect.DeepEqual(q.args, test.args) {
+				t.Errorf("args = %#v, want %#v", q.args, test.args)
+			}
+		})
+	}
+}
+
+func TestQueryFilterErrors(t *testing.T) {
+	tests := []struct {
+		query    string
+		position int
+		message  string
+	}{
+		{``, 1, "empty"},
+		{`   `, 1, "empty"},
+		{`"unterminated`, 1, "unterminated quote"},
+		{`name:"Blue-Eyes`, 6, "unterminated quote"},
+		{`(race:Dragon`, 13, "expected ) to close the ( at position 1"},
+		{`race:Dragon)`, 12, `unexpected ")"`},
+		{`()`, 2, `expected a term before ")"`},
+		{`OR race:Dragon`, 1, `expected a term before "OR"`},
+		{`race:Dragon OR`, 15, "expected a term at the end"},
+		{`race:Dragon AND`, 16, "expected a term at the end"},
+		{`race:Dragon AND OR atk:0`, 17, `expected a term before "OR"`},
+		{`AND race:Dragon`, 1, "AND needs a term before it"},
+		{`NOT`, 4, "expected a term at the end"},
+		{`race:Dragon -`, 14, "expected a term at the end"},
+		{`race:`, 6, "expected a value after race:"},
+		{`race:(Dragon)`, 6, "expected a value after race:"},
+		{`foo:bar`, 1, `unknown field "foo"`},
+		{`race:Dragon foo:bar`, 13, `unknown field "foo"`},
+		{`"Éclair" foo:bar`, 10, `unknown field "foo"`},
+		{`attribute>DARK`, 1, "attribute cannot be compared with >"},
+		{`atk>=abc`, 6, `atk needs a number, not "abc"`},
+		{`tcg_date:2020`, 10, "YYYY-MM-DD"},
+		{`has_effect:maybe`, 12, "true or false"},
+		{`"quoted":x`, 1, "a field name cannot be quoted"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			q := &queryBuilder{}
+			err := queryFilter(q, test.query)
+
+			var queryErr *QueryError
+			if !errors.As(err, &queryErr) {
+				t.Fatalf("error = %v, want a QueryError", err)
+			}
+
+			if queryErr.Position != test.position {
+				t.Errorf("position = %d, want %d (%s)", queryErr.Position, test.position, queryErr.Message)
+			}
+
+			if !strings.Contains(queryErr.Message, test.message) {
+				t.Errorf("message = %q, want it to contain %q", queryErr.Message, test.message)
+			}
+
+			if len(q.conditions) != 0 {
+				t.Errorf("conditions = %q, want none", q.conditions)
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package dbutils
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	pq "github.com/lib/pq"
+)
+
+const injection = `x' OR '1'='1'; DROP TABLE card; --`
+
+func TestApplyCardFilters(t *testing.T) {
+	t.Setenv("SET_PRINTINGS_TABLE_NAME", "card_set_printings")
+	t.Setenv("PRICES_TABLE_NAME", "card_prices")
+
+	tests := []struct {
+		name       string
+		filterMap  map[string]string
+		conditions []string
+		args       []interface{}
+		params     string
+	}{
+		{
+			name:       "prefix",
+			filterMap:  map[string]string{"frame_type": "effect", "card_name": "Dark"},
+			conditions: []string{"card_name ILIKE $1 OR description ILIKE $1", "frame_type = $2"},
+			args:       []interface{}{"Dark%", "effect"},
+			params:     "card_name=Dark&frame_type=effect",
+		},
+		{
+			name:       "like wildcards are escaped",
+			filterMap:  map[string]string{"card_name": "100%_"},
+			conditions: []string{"card_name ILIKE $1 OR description ILIKE $1"},
+			args:       []interface{}{`100\%\_%`},
+			params:     "card_name=100%25_",
+		},
+		{
+			name:       "list",
+			filterMap:  map[string]string{"attribute": "DARK,LIGHT"},
+			conditions: []string{"attr ILIKE ANY($1::text[])"},
+			args:       []interface{}{pq.StringArray{"DARK%", "LIGHT%"}},
+			params:     "attribute=DARK%2CLIGHT",
+		},
+		{
+			name:       "negated list",
+			filterMap:  map[string]string{"not_race": "Dragon"},
+			conditions: []string{"race IS NULL OR NOT (race ILIKE ANY($1::text[]))"},
+			args:       []interface{}{pq.StringArray{"Dragon%"}},
+			params:     "not_race=Dragon",
+		},
+		{
+			name:       "negated with a bang",
+			filterMap:  map[string]string{"card_level": "!4,6"},
+			conditions: []string{"card_level IS NULL OR NOT (card_level = ANY($1::int[]))"},
+			args:       []interface{}{pq.Int64Array{4, 6}},
+			params:     "card_level=%214%2C6",
+		},
+		{
+			name:       "range",
+			filterMap:  map[string]string{"atk_gte": "2500", "card_level_between": "4,6"},
+			conditions: []string{"atk >= $1", "card_level BETWEEN $2 AND $3"},
+			args:       []interface{}{2500, 4, 6},
+			params:     "atk_gte=2500&card_level_between=4%2C6",
+		},
+		{
+			name:       "unknown stat",
+			filterMap:  map[string]string{"atk": "?"},
+			conditions: []string{"atk IS NULL AND card_type LIKE '%Monster%'"},
+			params:     "atk=%3F",
+		},
+		{
+			name:       "keys outside the whitelist are ignored",
+			filterMap:  map[string]string{"id; DROP TABLE card": "1", "description": "x"},
+			conditions: nil,
+			params:     "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q := &queryBuilder{}
+
+			params, err := applyCardFilters(q, test.filterMap)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if !reflect.DeepEqual(q.conditions, test.conditions) {
+				t.Errorf("conditions = %q, want %q", q.conditions, test.conditions)
+			}
+
+			if !reflect.DeepEqual(q.args, test.args) {
+				t.Errorf("args = %#v, want %#v", q.args, test.args)
+			}
+
+			if params != test.params {
+				t.Errorf("params = %q, want %q", params, test.params)
+			}
+		})
+	}
+}
+
+func TestApplyCardFiltersInvalidValues(t *testing.T) {
+	tests := []map[string]string{
+		{"atk": "high"},
+		{"atk_lt": "1e3"},
+		{"card_level_between": "4"},
+		{"card_level_between": "4,x"},
+		{"has_effect": "maybe"},
+		{"card_level": "4,x"},
+		{"race": "!"},
+		{"tcg_status": "Banned"},
+		{"ocg_status": "!"},
+		{"tcg_date": "yesterday"},
+		{"min_price": "cheap"},
+	}
+
+	for _, filterMap := range tests {
+		t.Run(fmt.Sprint(filterMap), func(t *testing.T) {
+			_, err := applyCardFilters(&queryBuilder{}, filterMap)
+
+			var filterErr *FilterError
+			if !errors.As(err, &filterErr) {
+				t.Errorf("error = %v, want a FilterError", err)
+			}
+		})
+	}
+}
+
+func TestBanlistStatusFilter(t *testing.T) {
+	tests := []struct {
+		value      string
+		membership string
+		statuses   pq.StringArray
+	}{
+		{"Limited", "id IN", pq.StringArray{"Limited"}},
+		{"forbidden,semi-limited", "id IN", pq.StringArray{"Forbidden", "Semi-Limited"}},
+		{"Unlimited", "id NOT IN", pq.StringArray{"Unlimited"}},
+		{"!Forbidden", "id NOT IN", pq.StringArray{"Limited", "Semi-Limited", "Unlimited"}},
+		{"!Unlimited", "id IN", pq.StringArray{"Forbidden", "Limited", "Semi-Limited"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			q := &queryBuilder{}
+
+			condition, err := banlistStatusFilter(q, "tcg_status", "tcg", test.value, "")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if !strings.HasPrefix(condition, test.membership+" (") {
+				t.Errorf("condition = %q, want it to start with %q", condition, test.membership)
+			}
+
+			want := []interface{}{"tcg", test.statuses}
+			if !reflect.DeepEqual(q.args, want) {
+				t.Errorf("args = %#v, want %#v", q.args, want)
+			}
+		})
+	}
+}
+
+// Every filter value has to reach the database as an argument, whatever the
+// filter and statement: none may end up in the SQL text.
+func TestFilterValuesOnlyReachArgs(t *testing.T) {
+	t.Setenv("CARD_TABLE_NAME", "card")
+	t.Setenv("IMAGES_TABLE_NAME", "card_images")
+	t.Setenv("SET_PRINTINGS_TABLE_NAME", "card_set_printings")
+	t.Setenv("PRICES_TABLE_NAME", "card_prices")
+	t.Setenv("BANLIST_FORMATS_TABLE_NAME", "banlist_formats")
+	t.Setenv("BANLIST_VERSIONS_TABLE_NAME", "banlist_versions")
+	t.Setenv("BANLIST_ENTRIES_TABLE_NAME", "banlist_entries")
+
+	keys := []string{"card_name", "card_type", "frame_type", "archetype", "attribute", "race",
+		"linkmarkers", "formats", "typeline", "set_code", "rarity", "not_archetype", "not_card_type"}
+
+	for _, key := range keys {
+		for _, statementType := range []string{"filter", "countFilter"} {
+			t.Run(key+"/"+statementType, func(t *testing.T) {
+				filterMap := map[string]string{key: injection, "banlist_date": injection}
+
+				sqlStatement, args, _, err := writeSQLStatement(statementType, filterMap, 2, 20)
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+
+				if strings.Contains(sqlStatement, "DROP TABLE") || strings.Contains(sqlStatement, "'1'='1'") {
+					t.Fatalf("value reached the SQL text:\n%s", sqlStatement)
+				}
+
+				if !strings.Contains(fmt.Sprint(args), "DROP TABLE card") {
+					t.Errorf("value missing from args %#v", args)
+				}
+
+				if placeholders := strings.Count(sqlStatement, fmt.Sprintf("$%d", len(args))); placeholders == 0 {
+					t.Errorf("statement does not use its last argument $%d", len(args))
+				}
+			})
+		}
+	}
+}
+
+func TestWriteSQLStatementOffset(t *testing.T) {
+	tests := []struct {
+		page   int
+		offset int
+	}{
+		{0, 0},
+		{1, 0},
+		{2, 20},
+		{3, 40},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprint(test.page), func(t *testing.T) {
+			_, args, _, err := writeSQLStatement("filter", map[string]string{"atk": "1000"}, test.page, 20)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			// atk, limit and offset come first, before the banlist date
+			if args[1] != 20 || args[2] != test.offset {
+				t.Errorf("limit, offset = %v, %v, want 20, %d", args[1], args[2], test.offset)
+			}
+		})
+	}
+}
+
+func TestOrderBy(t *testing.T) {
+	tests := []struct {
+		sort    string
+		orderBy string
+	}{
+		{"", "ORDER BY C.id ASC"},
+		{"atk:desc,card_name", "ORDER BY C.atk DESC NULLS LAST, C.card_name ASC NULLS LAST, C.id ASC"},
+		{"attribute:ASC,id:desc", "ORDER BY C.attr ASC NULLS LAST, C.id DESC NULLS LAST"},
+	}
+
+	for _, test := range tests {
+		orderBy, err := orderBy(test.sort, "C")
+		if err != nil {
+			t.Errorf("orderBy(%q): unexpected error: %s", test.sort, err)
+		}
+
+		if orderBy != test.orderBy {
+			t.Errorf("orderBy(%q) = %q, want %q", test.sort, orderBy, test.orderBy)
+		}
+	}
+}
+
+func TestOrderByRejectsUnknownColumns(t *testing.T) {
+	for _, sort := range []string{"description", "atk:sideways", "id;DROP TABLE card"} {
+		_, err := orderBy(sort, "C")
+
+		var filterErr *FilterError
+		if !errors.As(err, &filterErr) {
+			t.Errorf("orderBy(%q) error = %v, want a FilterError", sort, err)
+		}
+	}
+}
+
+func TestSearchRejectsSort(t *testing.T) {
+	filterMap := map[string]string{"q": "dragon", "sort": "atk:desc"}
+
+	_, _, _, err := writeSearchStatement(filterMap, 1, 20, false)
+
+	var filterErr *FilterError
+	if !errors.As(err, &filterErr) || filterErr.Key != "sort" {
+		t.Errorf("error = %v, want a FilterError on sort", err)
+	}
+}
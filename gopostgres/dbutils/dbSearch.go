@@ -0,0 +1,187 @@
+package dbutils
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"unicode"
+
+	dbConfig "Yu-Go-Oh-API/gopostgres/dbconfig"
+)
+
+// Matches in the snippet are wrapped in <mark>, and long effects are cut
+// down to the fragments around them.
+const headlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MinWords=5, MaxWords=20, FragmentDelimiter=\" … \""
+
+type searchTerm struct {
+	text   string
+	phrase bool
+	prefix bool
+}
+
+// splitSearchTerms reads the q parameter: "quoted words" form a phrase,
+// a word ending in * is a prefix, anything else is a plain word.
+func splitSearchTerms(text string) []searchTerm {
+	terms := []searchTerm{}
+
+	for i, part := range strings.Split(text, `"`) {
+		// Odd parts sit between quotes
+		if i%2 == 1 {
+			if strings.TrimSpace(part) != "" {
+				terms = append(terms, searchTerm{text: part, phrase: true})
+			}
+			continue
+		}
+
+		for _, word := range strings.Fields(part) {
+			term := searchTerm{text: word}
+			if strings.HasSuffix(word, "*") {
+				term.text = strings.TrimRight(word, "*")
+				term.prefix = true
+			}
+
+			terms = append(terms, term)
+		}
+	}
+
+	return terms
+}
+
+// searchQuery turns the q parameter into a tsquery expression that needs
+// every term. Prefixes go through to_tsquery, so they are reduced to their
+// letters and digits first: blue-eyes* becomes blue <-> eyes:*.
+func searchQuery(q *queryBuilder, text string) (string, error) {
+	queries := []string{}
+
+	for _, term := range splitSearchTerms(text) {
+		switch {
+		case term.phrase:
+			queries = append(queries, fmt.Sprintf("phraseto_tsquery('english', %s)", q.arg(term.text)))
+		case term.prefix:
+			parts := strings.FieldsFunc(term.text, func(r rune) bool {
+				return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+			})
+			if len(parts) == 0 {
+				continue
+			}
+
+			prefix := strings.Join(parts, " <-> ") + ":*"
+			queries = append(queries, fmt.Sprintf("to_tsquery('english', %s)", q.arg(prefix)))
+		default:
+			queries = append(queries, fmt.Sprintf("plainto_tsquery('english', %s)", q.arg(term.text)))
+		}
+	}
+
+	if len(queries) == 0 {
+		return "", fmt.Errorf("q needs at least one word to search for")
+	}
+
+	return "(" + strings.Join(queries, " && ") + ")", nil
+}
+
+// writeSearchStatement builds the search for filterMap["q"], narrowed by the
+// usual card filters, or its count. Results come best ranked first, so a
+// sort is refused rather than ignored.
+func writeSearchStatement(filterMap map[string]string, page int, limit int, count bool) (string, []interface{}, string, error) {
+	q := &queryBuilder{}
+
+	if filterMap["sort"] != "" {
+		return "", nil, "", &FilterError{"sort", filterMap["sort"], "no sort, search results are ordered by rank"}
+	}
+
+	tsquery, err := searchQuery(q, filterMap["q"])
+	if checkErr(err) {
+		return "", nil, "", err
+	}
+
+	q.where("C.search_vector @@ S.query")
+
+	params, err := applyCardFilters(q, filterMap)
+	if checkErr(err) {
+		return "", nil, "", err
+	}
+
+	searchUrl := "/cards/search?q=" + url.QueryEscape(filterMap["q"]) + "&"
+	if params != "" {
+		searchUrl = searchUrl + params + "&"
+	}
+
+	from := fmt.Sprintf(`FROM %s C CROSS JOIN (SELECT %s as query) as S %s`,
+		os.Getenv("CARD_TABLE_NAME"), tsquery, q.whereClause())
+
+	if count {
+		return "SELECT COUNT(*) " + from, q.args, searchUrl, nil
+	}
+
+	offset := 0
+	if page > 1 {
+		offset = (page - 1) * limit
+	}
+
+	sqlStatement := cardSelect + fmt.Sprintf(`,
+		Q.rank, ts_headline('english', Q.description, S.query, %s) as snippet
+		FROM (
+			SELECT C.*, ts_rank(C.search_vector, S.query) as rank
+			%s
+			ORDER BY rank DESC, C.id
+			LIMIT %s OFFSET %s
+		) as Q
+		CROSS JOIN (SELECT %s as query) as S
+		%s
+		CROSS JOIN LATERAL (
+			%s
+		) as L
+		ORDER BY Q.rank DESC, Q.id`,
+		q.arg(headlineOptions), from, q.arg(limit), q.arg(offset), tsquery,
+		banlistJoin(q, filterMap["banlist_date"]), imagesAggregate())
+
+	return sqlStatement, q.args, searchUrl, nil
+}
+
+// SearchCards runs a full-text search over card names and effects.
+func SearchCards(DB *sql.DB, filterMap map[string]string, page int, limit int) ([]dbConfig.CardSearchResult, error) {
+	if err := checkBanlistFormats(DB, filterMap); checkErr(err) {
+		return []dbConfig.CardSearchResult{}, err
+	}
+
+	sqlStatement, args, _, err := writeSearchStatement(filterMap, page, limit, false)
+	if checkErr(err) {
+		return []dbConfig.CardSearchResult{}, err
+	}
+
+	query, err := DB.Query(sqlStatement, args...)
+	if checkErr(err) {
+		return []dbConfig.CardSearchResult{}, err
+	}
+	defer query.Close()
+
+	results := []dbConfig.CardSearchResult{}
+	for query.Next() {
+		var result dbConfig.CardSearchResult
+
+		result.Card, err = scanCard(query, &result.Rank, &result.Snippet)
+		if checkErr(err) {
+			return []dbConfig.CardSearchResult{}, err
+		}
+
+		results = append(results, result)
+	}
+
+	return results, query.Err()
+}
+
+// GetSearchCount counts every match of a search, for its pagination.
+func GetSearchCount(DB *sql.DB, filterMap map[string]string) (int, string, error) {
+	var count int
+
+	sqlStatement, args, searchUrl, err := writeSearchStatement(filterMap, 0, 0, true)
+	if checkErr(err) {
+		return 0, "", err
+	}
+
+	err = DB.QueryRow(sqlStatement, args...).Scan(&count)
+
+	return count, searchUrl, err
+}
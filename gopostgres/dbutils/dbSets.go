@@ -0,0 +1,218 @@
+package dbutils
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+
+	dbConfig "Yu-Go-Oh-API/gopostgres/dbconfig"
+)
+
+var printingStagingColumns = []string{
+	"card_id", "set_name", "set_prefix", "set_code", "set_rarity", "set_rarity_code", "set_price",
+}
+
+// createPrintingStaging holds the card_sets entries of an import until every
+// card is copied, so sets can be created once and printings linked to them.
+func createPrintingStaging(tx *sql.Tx) (string, error) {
+	staging := os.Getenv("SET_PRINTINGS_TABLE_NAME") + "_staging"
+	sqlStatement := fmt.Sprintf(`
+		CREATE TEMP TABLE %s (
+			card_id integer NOT NULL,
+			set_name text NOT NULL,
+			set_prefix text NOT NULL,
+			set_code text NOT NULL,
+			set_rarity text NOT NULL,
+			set_rarity_code text NOT NULL,
+			set_price numeric(12, 2)
+		) ON COMMIT DROP`, staging)
+
+	_, err := tx.Exec(sqlStatement)
+
+	return staging, err
+}
+
+// mergePrintings creates the missing sets and writes the staged printings.
+// In "sync" mode printings gone from the source are deleted, changed ones are
+// updated and sets left without printings are dropped; the ids of the cards
+// whose printings changed are returned.
+func mergePrintings(tx *sql.Tx, staging string, mode string) (map[int]bool, error) {
+	setTable := os.Getenv("SETS_TABLE_NAME")
+	printingTable := os.Getenv("SET_PRINTINGS_TABLE_NAME")
+
+	_, err := tx.Exec(fmt.Sprintf(`
+		INSERT INTO %s (set_name, set_code)
+		SELECT DISTINCT ON (set_name) set_name, set_prefix
+		FROM %s
+		ORDER BY set_name, set_prefix
+		ON CONFLICT (set_name) DO NOTHING`, setTable, staging))
+	if checkErr(err) {
+		return map[int]bool{}, err
+	}
+
+	// Dumps repeat a printing now and then, so only the first one is kept
+	insertStatement := fmt.Sprintf(`
+		INSERT INTO %s AS t (card_id, set_id, set_code, set_rarity, set_rarity_code, set_price)
+		SELECT DISTINCT ON (p.card_id, p.set_code, p.set_rarity)
+			p.card_id, s.id, p.set_code, p.set_rarity, p.set_rarity_code, p.set_price
+		FROM %s p
+		JOIN %s s ON s.set_name = p.set_name
+		ORDER BY p.card_id, p.set_code, p.set_rarity`, printingTable, staging, setTable)
+
+	if mode != "sync" {
+		_, err = tx.Exec(insertStatement + `
+		ON CONFLICT (card_id, set_code, set_rarity) DO NOTHING`)
+
+		return map[int]bool{}, err
+	}
+
+	changed, err := queryIds(tx, fmt.Sprintf(`
+		DELETE FROM %s t
+		WHERE NOT EXISTS (
+			SELECT 1 FROM %s p
+			WHERE p.card_id = t.card_id AND p.set_code = t.set_code AND p.set_rarity = t.set_rarity
+		)
+		RETURNING t.card_id`, printingTable, staging))
+	if checkErr(err) {
+		return changed, err
+	}
+
+	upserted, err := queryIds(tx, insertStatement+`
+		ON CONFLICT (card_id, set_code, set_rarity) DO UPDATE
+		SET set_id = EXCLUDED.set_id, set_rarity_code = EXCLUDED.set_rarity_code, set_price = EXCLUDED.set_price
+		WHERE (t.set_id, t.set_rarity_code, t.set_price)
+			IS DISTINCT FROM (EXCLUDED.set_id, EXCLUDED.set_rarity_code, EXCLUDED.set_price)
+		RETURNING t.card_id`)
+	if checkErr(err) {
+		return changed, err
+	}
+
+	for id := range upserted {
+		changed[id] = true
+	}
+
+	_, err = tx.Exec(fmt.Sprintf(`
+		DELETE FROM %s s
+		WHERE NOT EXISTS (SELECT 1 FROM %s p WHERE p.set_id = s.id)`, setTable, printingTable))
+
+	return changed, err
+}
+
+// setCodePrefix turns a printing code such as "LOB-EN001" into the code of
+// its set, "LOB".
+func setCodePrefix(code string) string {
+	prefix, _, _ := strings.Cut(code, "-")
+
+	return strings.ToUpper(prefix)
+}
+
+func GetSets(DB *sql.DB) ([]dbConfig.CardSet, error) {
+	sqlStatement := fmt.Sprintf(`
+		SELECT s.id, s.set_name, s.set_code, COUNT(p.card_id)
+		FROM %s s
+		LEFT JOIN %s p ON p.set_id = s.id
+		GROUP BY s.id
+		ORDER BY s.set_name`, os.Getenv("SETS_TABLE_NAME"), os.Getenv("SET_PRINTINGS_TABLE_NAME"))
+
+	query, err := DB.Query(sqlStatement)
+	if checkErr(err) {
+		return []dbConfig.CardSet{}, err
+	}
+	defer query.Close()
+
+	sets := []dbConfig.CardSet{}
+	for query.Next() {
+		var set dbConfig.CardSet
+
+		err = query.Scan(&set.ID, &set.Set_name, &set.Set_code, &set.Printings_count)
+		if checkErr(err) {
+			return []dbConfig.CardSet{}, err
+		}
+
+		sets = append(sets, set)
+	}
+
+	return sets, query.Err()
+}
+
+// GetSetByCode returns the set with the given code and all of its printings.
+// A few sets share a code, in which case the oldest one is returned.
+func GetSetByCode(DB *sql.DB, code string) (dbConfig.CardSet, error) {
+	var set dbConfig.CardSet
+
+	sqlStatement := fmt.Sprintf(`
+		SELECT id, set_name, set_code FROM %s
+		WHERE set_code = $1
+		ORDER BY id
+		LIMIT 1`, os.Getenv("SETS_TABLE_NAME"))
+
+	err := DB.QueryRow(sqlStatement, strings.ToUpper(code)).Scan(&set.ID, &set.Set_name, &set.Set_code)
+	if checkErr(err) {
+		return set, err
+	}
+
+	sqlStatement = fmt.Sprintf(`
+		SELECT p.card_id, c.card_name, p.set_code, p.set_rarity, p.set_rarity_code, p.set_price::text
+		FROM %s p
+		JOIN %s c ON c.id = p.card_id
+		WHERE p.set_id = $1
+		ORDER BY p.set_code, p.set_rarity`, os.Getenv("SET_PRINTINGS_TABLE_NAME"), os.Getenv("CARD_TABLE_NAME"))
+
+	query, err := DB.Query(sqlStatement, set.ID)
+	if checkErr(err) {
+		return set, err
+	}
+	defer query.Close()
+
+	set.Printings = []dbConfig.SetPrinting{}
+	for query.Next() {
+		var printing dbConfig.SetPrinting
+
+		err = query.Scan(
+			&printing.Card_id, &printing.Card_name, &printing.Set_code,
+			&printing.Set_rarity, &printing.Set_rarity_code, &printing.Set_price,
+		)
+		if checkErr(err) {
+			return set, err
+		}
+
+		set.Printings = append(set.Printings, printing)
+	}
+
+	set.Printings_count = len(set.Printings)
+
+	return set, query.Err()
+}
+
+func getCardPrintings(DB *sql.DB, id int) ([]dbConfig.CardSetDB, error) {
+	sqlStatement := fmt.Sprintf(`
+		SELECT s.set_name, p.set_code, p.set_rarity, p.set_rarity_code, COALESCE(p.set_price::text, '')
+		FROM %s p
+		JOIN %s s ON s.id = p.set_id
+		WHERE p.card_id = $1
+		ORDER BY p.set_code, p.set_rarity`, os.Getenv("SET_PRINTINGS_TABLE_NAME"), os.Getenv("SETS_TABLE_NAME"))
+
+	query, err := DB.Query(sqlStatement, id)
+	if checkErr(err) {
+		return []dbConfig.CardSetDB{}, err
+	}
+	defer query.Close()
+
+	printings := []dbConfig.CardSetDB{}
+	for query.Next() {
+		var printing dbConfig.CardSetDB
+
+		err = query.Scan(
+			&printing.Set_name, &printing.Set_code, &printing.Set_rarity,
+			&printing.Set_rarity_code, &printing.Set_price,
+		)
+		if checkErr(err) {
+			return []dbConfig.CardSetDB{}, err
+		}
+
+		printings = append(printings, printing)
+	}
+
+	return printings, query.Err()
+}
@@ -0,0 +1,398 @@
+package dbutils
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+
+	dbConfig "Yu-Go-Oh-API/gopostgres/dbconfig"
+	dbJobs "Yu-Go-Oh-API/gopostgres/dbjobs"
+)
+
+// SyncCardsToDB brings the card and image tables in line with a card file.
+// The source is copied into temporary staging tables and merged from there,
+// so rows that did not change are never rewritten.
+func SyncCardsToDB(DB *sql.DB, path string, read CardReader, job *dbJobs.Job) (dbConfig.SyncSummary, error) {
+	var summary dbConfig.SyncSummary
+	cardTable := os.Getenv("CARD_TABLE_NAME")
+	imageTable := os.Getenv("IMAGES_TABLE_NAME")
+
+	tx, err := DB.Begin()
+	if checkErr(err) {
+		return summary, err
+	}
+	defer tx.Rollback()
+
+	cardStaging, err := createStagingTable(tx, cardTable)
+	if checkErr(err) {
+		return summary, err
+	}
+
+	imageStaging, err := createStagingTable(tx, imageTable)
+	if checkErr(err) {
+		return summary, err
+	}
+
+	printingStaging, err := createPrintingStaging(tx)
+	if checkErr(err) {
+		return summary, err
+	}
+
+	priceStaging, err := createPriceStaging(tx)
+	if checkErr(err) {
+		return summary, err
+	}
+
+	tables := cardTables{cards: cardStaging, images: imageStaging, printings: printingStaging, prices: priceStaging}
+
+	count, err := read(path, func(cards []dbConfig.CardDB) error {
+		err := copyCardsToDB(cards, tx, tables)
+		if checkErr(err) {
+			return err
+		}
+
+		job.Add(len(cards))
+
+		return nil
+	})
+
+	if checkErr(err) {
+		return summary, err
+	}
+
+	// Images of removed cards go away through the foreign key cascade
+	summary.Removed, err = deleteMissingRows(tx, cardTable, cardStaging, []string{"id"}, "")
+	if checkErr(err) {
+		return summary, err
+	}
+
+	added, updated, err := upsertFromStaging(tx, cardTable, cardStaging, cardColumns, []string{"id"}, "id")
+	if checkErr(err) {
+		return summary, err
+	}
+
+	// A card whose artworks changed counts as updated even if its own row did not
+	changedImages, err := queryIds(tx, fmt.Sprintf(`
+		DELETE FROM %s t
+		WHERE NOT EXISTS (SELECT 1 FROM %s s WHERE s.id = t.id AND s.card_id = t.card_id)
+		RETURNING t.card_id`, imageTable, imageStaging))
+	if checkErr(err) {
+		return summary, err
+	}
+
+	insertedImages, updatedImages, err := upsertFromStaging(tx, imageTable, imageStaging, imageColumns, []string{"id"}, "card_id")
+	if checkErr(err) {
+		return summary, err
+	}
+
+	for id := range insertedImages {
+		changedImages[id] = true
+	}
+
+	for id := range updatedImages {
+		changedImages[id] = true
+	}
+
+	// The same goes for a card that gained, lost or repriced a printing
+	changedPrintings, err := mergePrintings(tx, printingStaging, "sync")
+	if checkErr(err) {
+		return summary, err
+	}
+
+	for id := range changedPrintings {
+		changedImages[id] = true
+	}
+
+	for id := range changedImages {
+		if !added[id] {
+			updated[id] = true
+		}
+	}
+
+	// Prices are a history, so they are appended rather than merged and do
+	// not make a card count as updated
+	err = recordPrices(tx, priceStaging)
+	if checkErr(err) {
+		return summary, err
+	}
+
+	summary.Added = len(added)
+	summary.Updated = len(updated)
+	summary.Unchanged = count - summary.Added - summary.Updated
+
+	return summary, tx.Commit()
+}
+
+// MergeCardsToDB adds the cards of a partial source, like a cards.cdb of
+// pre-release cards, next to the ones already loaded. Nothing is deleted,
+// printings and prices are left alone, and cards that already exist only have
+// the given columns updated, so the values only the full catalogue has stay.
+func MergeCardsToDB(DB *sql.DB, path string, read CardReader, columns []string, job *dbJobs.Job) (dbConfig.SyncSummary, error) {
+	var summary dbConfig.SyncSummary
+	cardTable := os.Getenv("CARD_TABLE_NAME")
+	imageTable := os.Getenv("IMAGES_TABLE_NAME")
+
+	tx, err := DB.Begin()
+	if checkErr(err) {
+		return summary, err
+	}
+	defer tx.Rollback()
+
+	cardStaging, err := createStagingTable(tx, cardTable)
+	if checkErr(err) {
+		return summary, err
+	}
+
+	imageStaging, err := createStagingTable(tx, imageTable)
+	if checkErr(err) {
+		return summary, err
+	}
+
+	// The source has no printings or prices; their staging is never merged
+	printingStaging, err := createPrintingStaging(tx)
+	if checkErr(err) {
+		return summary, err
+	}
+
+	priceStaging, err := createPriceStaging(tx)
+	if checkErr(err) {
+		return summary, err
+	}
+
+	tables := cardTables{cards: cardStaging, images: imageStaging, printings: printingStaging, prices: priceStaging}
+
+	count, err := read(path, func(cards []dbConfig.CardDB) error {
+		err := copyCardsToDB(cards, tx, tables)
+		if checkErr(err) {
+			return err
+		}
+
+		job.Add(len(cards))
+
+		return nil
+	})
+
+	if checkErr(err) {
+		return summary, err
+	}
+
+	added, updated, err := mergeFromStaging(tx, cardTable, cardStaging, cardColumns, columns, []string{"id"}, "id")
+	if checkErr(err) {
+		return summary, err
+	}
+
+	// Artworks already loaded keep their urls; only new ones are added
+	imageList := strings.Join(imageColumns, ", ")
+	newImages, err := queryIds(tx, fmt.Sprintf(`
+		INSERT INTO %s (%s) SELECT %s FROM %s
+		ON CONFLICT (id) DO NOTHING
+		RETURNING card_id`, imageTable, imageList, imageList, imageStaging))
+	if checkErr(err) {
+		return summary, err
+	}
+
+	for id := range newImages {
+		if !added[id] {
+			updated[id] = true
+		}
+	}
+
+	summary.Added = len(added)
+	summary.Updated = len(updated)
+	summary.Unchanged = count - summary.Added - summary.Updated
+
+	return summary, tx.Commit()
+}
+
+// SyncBanlistToDB brings one banlist version in line with its source file,
+// creating the version if needed. Other versions are not touched.
+func SyncBanlistToDB(DB *sql.DB, version dbConfig.BanlistVersion, path string, read BanlistReader, job *dbJobs.Job) (dbConfig.SyncSummary, error) {
+	var summary dbConfig.SyncSummary
+	table := os.Getenv("BANLIST_ENTRIES_TABLE_NAME")
+
+	tx, err := DB.Begin()
+	if checkErr(err) {
+		return summary, err
+	}
+	defer tx.Rollback()
+
+	versionId, err := findOrCreateBanlistVersion(tx, version)
+	if checkErr(err) {
+		return summary, err
+	}
+
+	staging, err := createStagingTable(tx, table)
+	if checkErr(err) {
+		return summary, err
+	}
+
+	rows := [][]interface{}{}
+	count, err := read(path, func(banlist dbConfig.BanlistJSON) error {
+		if status := banlistStatus(banlist, version.Format); status != "" {
+			rows = append(rows, []interface{}{versionId, banlist.ID, status})
+		}
+
+		return nil
+	})
+
+	if checkErr(err) {
+		return summary, err
+	}
+
+	err = copyToDB(tx, staging, entryColumns, rows)
+	if checkErr(err) {
+		return summary, err
+	}
+
+	job.Add(count)
+
+	scope := fmt.Sprintf("t.version_id = %d", versionId)
+	summary.Removed, err = deleteMissingRows(tx, table, staging, []string{"version_id", "card_id"}, scope)
+	if checkErr(err) {
+		return summary, err
+	}
+
+	added, updated, err := upsertFromStaging(tx, table, staging, entryColumns, []string{"version_id", "card_id"}, "card_id")
+	if checkErr(err) {
+		return summary, err
+	}
+
+	summary.Added = len(added)
+	summary.Updated = len(updated)
+	summary.Unchanged = len(rows) - summary.Added - summary.Updated
+
+	return summary, tx.Commit()
+}
+
+func createStagingTable(tx *sql.Tx, table string) (string, error) {
+	staging := table + "_staging"
+	sqlStatement := fmt.Sprintf(`CREATE TEMP TABLE %s (LIKE %s INCLUDING DEFAULTS) ON COMMIT DROP`, staging, table)
+
+	_, err := tx.Exec(sqlStatement)
+
+	return staging, err
+}
+
+// deleteMissingRows removes the rows of table that have no staged row with
+// the same keys. A non empty scope limits the delete to matching rows.
+func deleteMissingRows(tx *sql.Tx, table string, staging string, keys []string, scope string) (int, error) {
+	result, err := tx.Exec(deleteMissingStatement(table, staging, keys, scope))
+	if checkErr(err) {
+		return 0, err
+	}
+
+	removed, err := result.RowsAffected()
+
+	return int(removed), err
+}
+
+func deleteMissingStatement(table string, staging string, keys []string, scope string) string {
+	conditions := []string{}
+	for _, key := range keys {
+		conditions = append(conditions, fmt.Sprintf("s.%[1]s = t.%[1]s", key))
+	}
+
+	sqlStatement := fmt.Sprintf(`
+		DELETE FROM %s t
+		WHERE NOT EXISTS (SELECT 1 FROM %s s WHERE %s)`, table, staging, strings.Join(conditions, " AND "))
+
+	if scope != "" {
+		sqlStatement = sqlStatement + " AND " + scope
+	}
+
+	return sqlStatement
+}
+
+// upsertFromStaging inserts new rows and updates rows whose values differ,
+// keyed on the conflict columns. It reports the returned column of the
+// inserted and of the updated rows separately; untouched rows are not
+// returned at all.
+func upsertFromStaging(tx *sql.Tx, table string, staging string, columns []string, conflict []string, returning string) (map[int]bool, map[int]bool, error) {
+	return mergeFromStaging(tx, table, staging, columns, columns, conflict, returning)
+}
+
+// mergeFromStaging is upsertFromStaging for sources that only know some of
+// the columns: new rows get every column of columns, existing rows only have
+// their updateColumns rewritten.
+func mergeFromStaging(tx *sql.Tx, table string, staging string, columns []string, updateColumns []string, conflict []string, returning string) (map[int]bool, map[int]bool, error) {
+	inserted := map[int]bool{}
+	updated := map[int]bool{}
+
+	query, err := tx.Query(mergeStatement(table, staging, columns, updateColumns, conflict, returning))
+	if checkErr(err) {
+		return inserted, updated, err
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var id int
+		var isInsert bool
+
+		err = query.Scan(&id, &isInsert)
+		if checkErr(err) {
+			return inserted, updated, err
+		}
+
+		if isInsert {
+			inserted[id] = true
+		} else {
+			updated[id] = true
+		}
+	}
+
+	return inserted, updated, query.Err()
+}
+
+// mergeStatement writes the upsert of mergeFromStaging. Rows whose update
+// columns already hold the staged values are left alone, so they are not
+// returned, and xmax is 0 only on the rows the statement inserted.
+func mergeStatement(table string, staging string, columns []string, updateColumns []string, conflict []string, returning string) string {
+	assignments := []string{}
+	current := []string{}
+	excluded := []string{}
+	for _, column := range updateColumns {
+		if contains(conflict, column) {
+			continue
+		}
+
+		assignments = append(assignments, fmt.Sprintf("%[1]s = EXCLUDED.%[1]s", column))
+		current = append(current, "t."+column)
+		excluded = append(excluded, "EXCLUDED."+column)
+	}
+
+	columnList := strings.Join(columns, ", ")
+	sqlStatement := fmt.Sprintf(`
+		INSERT INTO %s AS t (%s)
+		SELECT %s FROM %s
+		ON CONFLICT (%s) DO UPDATE SET %s
+		WHERE (%s) IS DISTINCT FROM (%s)
+		RETURNING t.%s, (t.xmax = 0) AS inserted`,
+		table, columnList, columnList, staging, strings.Join(conflict, ", "), strings.Join(assignments, ", "),
+		strings.Join(current, ", "), strings.Join(excluded, ", "), returning)
+
+	return sqlStatement
+}
+
+func queryIds(tx *sql.Tx, sqlStatement string) (map[int]bool, error) {
+	ids := map[int]bool{}
+
+	query, err := tx.Query(sqlStatement)
+	if checkErr(err) {
+		return ids, err
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var id int
+
+		err = query.Scan(&id)
+		if checkErr(err) {
+			return ids, err
+		}
+
+		ids[id] = true
+	}
+
+	return ids, query.Err()
+}
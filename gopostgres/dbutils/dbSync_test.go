@@ -0,0 +1,94 @@
+package dbutils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMergeStatement(t *testing.T) {
+	tests := []struct {
+		name          string
+		columns       []string
+		updateColumns []string
+		conflict      []string
+		returning     string
+		statement     string
+	}{
+		{
+			name:          "upsert",
+			columns:       []string{"id", "card_name", "atk"},
+			updateColumns: []string{"id", "card_name", "atk"},
+			conflict:      []string{"id"},
+			returning:     "id",
+			statement: "INSERT INTO card AS t (id, card_name, atk) SELECT id, card_name, atk FROM card_staging" +
+				" ON CONFLICT (id) DO UPDATE SET card_name = EXCLUDED.card_name, atk = EXCLUDED.atk" +
+				" WHERE (t.card_name, t.atk) IS DISTINCT FROM (EXCLUDED.card_name, EXCLUDED.atk)" +
+				" RETURNING t.id, (t.xmax = 0) AS inserted",
+		},
+		{
+			name:          "merge only updates the given columns",
+			columns:       []string{"id", "card_name", "archetype"},
+			updateColumns: []string{"card_name"},
+			conflict:      []string{"id"},
+			returning:     "id",
+			statement: "INSERT INTO card AS t (id, card_name, archetype) SELECT id, card_name, archetype FROM card_staging" +
+				" ON CONFLICT (id) DO UPDATE SET card_name = EXCLUDED.card_name" +
+				" WHERE (t.card_name) IS DISTINCT FROM (EXCLUDED.card_name)" +
+				" RETURNING t.id, (t.xmax = 0) AS inserted",
+		},
+		{
+			name:          "composite key",
+			columns:       entryColumns,
+			updateColumns: entryColumns,
+			conflict:      []string{"version_id", "card_id"},
+			returning:     "card_id",
+			statement: "INSERT INTO card AS t (version_id, card_id, status) SELECT version_id, card_id, status FROM card_staging" +
+				" ON CONFLICT (version_id, card_id) DO UPDATE SET status = EXCLUDED.status" +
+				" WHERE (t.status) IS DISTINCT FROM (EXCLUDED.status)" +
+				" RETURNING t.card_id, (t.xmax = 0) AS inserted",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			statement := mergeStatement("card", "card_staging", test.columns, test.updateColumns, test.conflict, test.returning)
+
+			if got := strings.Join(strings.Fields(statement), " "); got != test.statement {
+				t.Errorf("statement =\n%s\nwant\n%s", got, test.statement)
+			}
+		})
+	}
+}
+
+func TestDeleteMissingStatement(t *testing.T) {
+	tests := []struct {
+		name      string
+		keys      []string
+		scope     string
+		statement string
+	}{
+		{
+			name:      "cards",
+			keys:      []string{"id"},
+			statement: "DELETE FROM card t WHERE NOT EXISTS (SELECT 1 FROM card_staging s WHERE s.id = t.id)",
+		},
+		{
+			name:  "one banlist version",
+			keys:  []string{"version_id", "card_id"},
+			scope: "t.version_id = 3",
+			statement: "DELETE FROM card t WHERE NOT EXISTS" +
+				" (SELECT 1 FROM card_staging s WHERE s.version_id = t.version_id AND s.card_id = t.card_id)" +
+				" AND t.version_id = 3",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			statement := deleteMissingStatement("card", "card_staging", test.keys, test.scope)
+
+			if got := strings.Join(strings.Fields(statement), " "); got != test.statement {
+				t.Errorf("statement =\n%s\nwant\n%s", got, test.statement)
+			}
+		})
+	}
+}
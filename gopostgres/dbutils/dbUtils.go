@@ -4,471 +4,293 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"io"
+	"net/url"
 	"os"
 	"strings"
 
 	dbConfig "Yu-Go-Oh-API/gopostgres/dbconfig"
 
-	_ "github.com/lib/pq"
+	pq "github.com/lib/pq"
 )
 
-func GetCount(DB *sql.DB, filterMap map[string]string, mode string) (int, string) {
+// GetCount counts the cards a listing or filter pages through, for its
+// pagination.
+func GetCount(DB *sql.DB, filterMap map[string]string, mode string) (int, string, error) {
 	var count int
-	var sqlStatement string
-	var url string
 
+	statementType := "count"
 	if mode == "filter" {
-		sqlStatement, url = writeSQLStatement("countFilter", filterMap, 0, 0)
-	} else {
-		sqlStatement, url = writeSQLStatement("count", filterMap, 0, 0)
+		statementType = "countFilter"
 	}
 
-	err := DB.QueryRow(sqlStatement).Scan(&count)
+	sqlStatement, args, url, err := writeSQLStatement(statementType, filterMap, 0, 0)
+	if checkErr(err) {
+		return 0, "", err
+	}
 
-	checkErr(err)
+	err = DB.QueryRow(sqlStatement, args...).Scan(&count)
 
-	return count, url
+	return count, url, err
 }
 
-func cleanStringAndReturnArr(str string) []string {
-	slice := strings.Split(str, ",")
-	var arr []string
-	for i := 0; i < len(slice); i++ {
-		parsed_string := strings.ReplaceAll(slice[i], "{", "")
-		parsed_string = strings.ReplaceAll(parsed_string, "}", "")
+// scanCard reads one row of baseSelect into a Card, filling in the banlist
+// defaults and decoding the aggregated artworks. Columns selected after the
+// card's are scanned into extra.
+func scanCard(query *sql.Rows, extra ...interface{}) (dbConfig.Card, error) {
+	var card dbConfig.Card
+
+	columns := []interface{}{
+		&card.ID, &card.Card_Name, &card.Card_Type, &card.Description, &card.Archetype, &card.Atk,
+		&card.Def, &card.Card_Level, &card.Race, &card.Attr, &card.Linkval, &card.Linkmarkers, &card.Card_Scale,
+		&card.FrameType, &card.Typeline, &card.Ygoprodeck_url, &card.Konami_id,
+		&card.Tcg_date, &card.Ocg_date, &card.Has_effect, &card.Formats,
+		&card.BanlistInfoString, &card.ImagesJSON,
+	}
+
+	err := query.Scan(append(columns, extra...)...)
+
+	if checkErr(err) {
+		return dbConfig.Card{}, err
+	}
 
-		slice[i] = parsed_string
+	if card.BanlistInfoString.String != "" {
+		err := json.Unmarshal([]byte(card.BanlistInfoString.String), &card.BanlistInfo)
+		checkErr(err)
+	} else {
+		card.BanlistInfo = map[string]string{
+			"tcg":  "Unlimited",
+			"ocg":  "Unlimited",
+			"goat": "Unlimited",
+		}
+	}
 
-		arr = append(arr, parsed_string)
+	card.Images = []dbConfig.CardImageDB{}
+	if len(card.ImagesJSON) > 0 {
+		err = json.Unmarshal(card.ImagesJSON, &card.Images)
 	}
 
-	return arr
+	return card, err
 }
 
-func GetCardById(DB *sql.DB, id int) (dbConfig.Card, error) {
-	var sqlStatement string
-	filterMap := map[string]string{"id": fmt.Sprintf("%d", id)}
+func GetCardById(DB *sql.DB, id int, banlistDate string) (dbConfig.Card, error) {
+	filterMap := map[string]string{"id": fmt.Sprintf("%d", id), "banlist_date": banlistDate}
 
-	sqlStatement, _ = writeSQLStatement("getById", filterMap, 0, 0)
+	sqlStatement, args, _, err := writeSQLStatement("getById", filterMap, 0, 0)
+	if checkErr(err) {
+		return dbConfig.Card{}, err
+	}
 
-	query, err := DB.Query(sqlStatement)
+	query, err := DB.Query(sqlStatement, args...)
 
 	if checkErr(err) {
 		return dbConfig.Card{}, err
 	}
+	defer query.Close()
 
 	var card dbConfig.Card
 
 	for query.Next() {
-		err = query.Scan(
-			&card.ID, &card.Card_Name, &card.Card_Type, &card.Description, &card.Archetype, &card.Atk,
-			&card.Def, &card.Card_Level, &card.Race, &card.Attr, &card.Linkval, &card.Linkmarkers, &card.Card_Scale,
-			&card.BanlistInfoString, &card.Image_url_uint8, &card.Image_url_small_uint8,
-		)
+		card, err = scanCard(query)
 
 		if checkErr(err) {
 			return dbConfig.Card{}, err
 		}
+	}
 
-		if card.BanlistInfoString.String != "" {
-			err := json.Unmarshal([]byte(card.BanlistInfoString.String), &card.BanlistInfo)
-			checkErr(err)
-		} else {
-			card.BanlistInfo = map[string]string{
-				"tcg":  "Unlimited",
-				"ocg":  "Unlimited",
-				"goat": "Unlimited",
-			}
-		}
-
-		parsed_image := string(card.Image_url_uint8[:])
-		small_parsed_image := string(card.Image_url_small_uint8[:])
-
-		arr := cleanStringAndReturnArr(parsed_image)
-		small_arr := cleanStringAndReturnArr(small_parsed_image)
-
-		card.Image_url = arr
-		card.Image_url_small = small_arr
+	if card.ID != 0 {
+		card.Sets, err = getCardPrintings(DB, card.ID)
 	}
 
 	return card, err
 }
 
 func GetCardsInDB(DB *sql.DB, filterArr map[string]string, page int, query_size int, mode string) ([]dbConfig.Card, error) {
-	var sqlStatement string
+	if mode != "filter" && mode != "getBanlist" && mode != "getByIds" {
+		mode = "get"
+	}
 
-	if mode != "filter" && mode != "getBanlist" {
-		sqlStatement, _ = writeSQLStatement("get", filterArr, page, query_size)
-	} else {
-		sqlStatement, _ = writeSQLStatement(mode, filterArr, page, query_size)
+	if mode == "filter" {
+		if err := checkBanlistFormats(DB, filterArr); checkErr(err) {
+			return []dbConfig.Card{}, err
+		}
+	}
+
+	sqlStatement, args, _, err := writeSQLStatement(mode, filterArr, page, query_size)
+	if checkErr(err) {
+		return []dbConfig.Card{}, err
 	}
 
-	query, err := DB.Query(sqlStatement)
+	query, err := DB.Query(sqlStatement, args...)
 
 	if checkErr(err) {
 		return []dbConfig.Card{}, err
 	}
+	defer query.Close()
 
 	newCards := []dbConfig.Card{}
 
 	for query.Next() {
-
-		var card dbConfig.Card
-		var arr []string
-		var small_arr []string
-
-		err = query.Scan(
-			&card.ID, &card.Card_Name, &card.Card_Type, &card.Description, &card.Archetype, &card.Atk,
-			&card.Def, &card.Card_Level, &card.Race, &card.Attr, &card.Linkval, &card.Linkmarkers, &card.Card_Scale,
-			&card.BanlistInfoString, &card.Image_url_uint8, &card.Image_url_small_uint8,
-		)
-		checkErr(err)
+		card, err := scanCard(query)
 
 		if checkErr(err) {
 			return []dbConfig.Card{}, err
 		}
 
-		if card.BanlistInfoString.String != "" {
-			err := json.Unmarshal([]byte(card.BanlistInfoString.String), &card.BanlistInfo)
-			checkErr(err)
-		} else {
-			card.BanlistInfo = map[string]string{
-				"tcg":  "Unlimited",
-				"ocg":  "Unlimited",
-				"goat": "Unlimited",
-			}
-		}
-
-		parsed_image := string(card.Image_url_uint8[:])
-		small_parsed_image := string(card.Image_url_small_uint8[:])
-
-		arr = cleanStringAndReturnArr(parsed_image)
-		small_arr = cleanStringAndReturnArr(small_parsed_image)
-
-		card.Image_url = arr
-		card.Image_url_small = small_arr
 		newCards = append(newCards, card)
 	}
 
-	return newCards, err
-}
-
-func AddCardToDB(card dbConfig.CardDB, DB *sql.DB) {
-	filterMap := map[string]string{
-		"card_name":  "",
-		"card_level": "",
-	}
-
-	sqlCardStatement, _ := writeSQLStatement("post", filterMap, 0, 0)
-	prepareExecToDB(
-		sqlCardStatement, DB,
-		card.ID, card.Card_Name, card.Card_Type, card.Description, card.Archetype,
-		card.Atk, card.Def, card.Card_Level, card.Race, card.Attr, card.Linkval, card.Linkmarkers, card.Card_Scale,
-	)
-
-	sqlImgStatement, _ := writeSQLStatement("postImg", filterMap, 0, 0)
-	if len(card.Images) > 1 {
-		for i := 0; i < (len(card.Images) - 1); i++ {
-			prepareExecToDB(
-				sqlImgStatement, DB,
-				card.Images[i].ID, card.ID, card.Images[i].Image_url, card.Images[i].Image_url_small,
-			)
-		}
-	} else {
-		prepareExecToDB(
-			sqlImgStatement, DB,
-			card.Images[0].ID, card.ID, card.Images[0].Image_url, card.Images[0].Image_url_small,
-		)
-	}
-}
-
-func AddBanlistToDB(banlist dbConfig.BanlistJSON, DB *sql.DB, mode string) {
-	filterMap := map[string]string{
-		"table": os.Getenv("BANLIST_TABLE_NAME"),
-	}
-
-	if mode == "ocg" {
-		filterMap["table"] = os.Getenv("OCG_BANLIST_TABLE_NAME")
-	}
-
-	jsonStr, err := json.Marshal(banlist.BanlistInfo)
-	checkErr(err)
-
-	sqlStatement, _ := writeSQLStatement("postBanlist", filterMap, 0, 0)
-
-	prepareExecToDB(
-		sqlStatement, DB,
-		banlist.ID, banlist.ID, jsonStr, banlist.FrameType,
-	)
-}
-
-func prepareExecToDB(sqlStatement string, DB *sql.DB, args ...interface{}) {
-	insert, err := DB.Prepare(sqlStatement)
-	checkErr(err)
-
-	result, err := insert.Exec(args...)
-	checkErr(err)
-
-	rowsAffected, err := result.RowsAffected()
-	checkErr(err)
-
-	fmt.Printf("Rows affected: %d \n", rowsAffected)
+	return newCards, query.Err()
 }
 
-func writeSQLStatement(statementType string, filterMap map[string]string, page int, limit int) (string, string) {
-	baseUrl := "/cards/?"
-
-	var baseSelect string = `
+// cardSelect lists the columns scanCard reads, in order. Dates are selected
+// as text so they reach the API as plain YYYY-MM-DD strings.
+const cardSelect = `
 		SELECT Q.id, Q.card_name, Q.card_type, 
 		Q.description, Q.archetype, Q.atk, Q.def, 
 		Q.card_level, Q.race, Q.attr, Q.linkval, 
-		Q.linkmarkers, Q.card_scale, ban.banlist_info,
-		L.image_url, L.image_url_small
+		Q.linkmarkers, Q.card_scale, Q.frame_type,
+		Q.typeline, Q.ygoprodeck_url, Q.konami_id,
+		Q.tcg_date::text, Q.ocg_date::text, Q.has_effect,
+		Q.formats, ban.banlist_info, L.card_images
 	`
 
+// writeSQLStatement builds the statement of the given type with its
+// arguments, and the url its pagination links start from. Filter values that
+// do not parse are reported as an error.
+func writeSQLStatement(statementType string, filterMap map[string]string, page int, limit int) (string, []interface{}, string, error) {
+	baseUrl := "/cards/?"
+	q := &queryBuilder{}
+
+	var baseSelect string = cardSelect
+
 	var baseJoins string = fmt.Sprintf(`
 		CROSS JOIN LATERAL (
-			SELECT array_agg(image_url::text) as image_url, array_agg(image_url_small::text) as image_url_small
-			FROM %s ci
-			WHERE ci.card_id = Q.id
+			%s
 		) as L
-	`, os.Getenv("IMAGES_TABLE_NAME"))
+	`, imagesAggregate())
 
+	// Pages count from 1; the statements below take page as the offset
 	if page > 1 {
-		page = limit * page
+		page = (page - 1) * limit
 	} else {
 		page = 0
 	}
 
-	switch statementType {
-	case "filter":
-		sqlStatement, url := filterLoop(filterMap, limit, page, "filter")
-
-		return sqlStatement, url
-	case "get":
-		getString := fmt.Sprintf(`
-		FROM (SELECT * FROM %s LIMIT %d OFFSET %d) as Q
-		LEFT JOIN %s ban on Q.id = card_id
-		`, os.Getenv("CARD_TABLE_NAME"), limit, page, os.Getenv("BANLIST_TABLE_NAME"))
-
-		sqlStatement := baseSelect + getString + baseJoins
-
-		return sqlStatement, baseUrl
-	case "getById":
-		getIdString := fmt.Sprintf(`
-		FROM (SELECT * FROM %s WHERE id = %s) as Q
-		LEFT JOIN %s ban on Q.id = card_id`,
-			os.Getenv("CARD_TABLE_NAME"), filterMap["id"], os.Getenv("BANLIST_TABLE_NAME"))
-
-		sqlStatement := baseSelect + getIdString + baseJoins
-
-		return sqlStatement, baseUrl
-	case "post":
-		sqlStatement := fmt.Sprintf(`
-				INSERT INTO %s 
-				(id, card_name, card_type, description, archetype, atk, def, card_level, race, attr, linkval, linkmarkers, card_scale) 
-				VALUES 
-				($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`, os.Getenv("CARD_TABLE_NAME"))
-
-		return sqlStatement, baseUrl
-	case "postImg":
-		sqlStatement := fmt.Sprintf(`INSERT INTO %s (id, card_id, image_url, image_url_small) VALUES ($1, $2, $3, $4)`, filterMap["table"])
-
-		return sqlStatement, baseUrl
-	case "postBanlist":
-		sqlStatement := fmt.Sprintf(`INSERT INTO %s (id, card_id, banlist_info, frameType) VALUES ($1, $2, $3, $4)`, filterMap["table"])
-
-		return sqlStatement, baseUrl
-
-	case "getBanlist":
-		getBanlistString := fmt.Sprintf(`
-			FROM (SELECT * FROM %s) as Q
-			JOIN %s ban on Q.id = card_id
-		`, os.Getenv("CARD_TABLE_NAME"), filterMap["table"])
-
-		sqlStatement := baseSelect + getBanlistString + baseJoins
-		return sqlStatement, baseUrl
-	case "count":
-		sqlStatement := fmt.Sprintf(`SELECT COUNT(*) FROM %s`, os.Getenv("CARD_TABLE_NAME"))
-
-		return sqlStatement, baseUrl
-	case "countFilter":
-		sqlStatement, url := filterLoop(filterMap, limit, page, "count")
-
-		return sqlStatement, url
+	if filterMap["sort"] != "" {
+		baseUrl = baseUrl + "sort=" + url.QueryEscape(filterMap["sort"]) + "&"
 	}
 
-	return "", ""
-}
-
-func filterLoop(filterMap map[string]string, limit int, page int, mode string) (string, string) {
-	filterUrl := `/cards/filter/?`
-	sqlStatement := fmt.Sprintf(`
-	SELECT *
-	FROM (SELECT * FROM %s WHERE
-	`, os.Getenv("CARD_TABLE_NAME"))
-
-	if mode == "count" {
-		sqlStatement = fmt.Sprintf(`
-		SELECT COUNT(*) FROM %s WHERE 
-		`, os.Getenv("CARD_TABLE_NAME"))
+	innerOrder, err := orderBy(filterMap["sort"], "C")
+	if checkErr(err) {
+		return "", nil, "", err
 	}
 
-	i := 0
-	edited := false
-
-	for key, value := range filterMap {
-		i++
-
-		if value != "" {
-			// Filtering exacts
-			arrayOfExacts := [6]string{"card_level", "card_type", "linkval", "card_scale", "atk", "def"}
-			for i := 0; i < len(arrayOfExacts); i++ {
-				if key == arrayOfExacts[i] {
-					var newFilter string
-					if edited {
-						newFilter = fmt.Sprintf("AND %s = '%s'", key, value)
-						filterUrl = filterUrl + fmt.Sprintf(`&%s=%s`, key, value)
-					} else {
-						newFilter = fmt.Sprintf("%s = '%s'", key, value)
-						filterUrl = filterUrl + fmt.Sprintf(`%s=%s`, key, value)
-						edited = true
-					}
-					sqlStatement = sqlStatement + newFilter
-				}
-			}
+	outerOrder, _ := orderBy(filterMap["sort"], "Q")
 
-			switch key {
-			case "card_name":
-				value = strings.ReplaceAll(value, `"`, "")
-				filter := "'" + value + "%'"
-
-				if edited {
-					sqlStatement = sqlStatement + fmt.Sprintf(`
-									AND card_name ILIKE %s OR description ILIKE %s
-									`, filter, filter)
-					filterUrl = filterUrl + fmt.Sprintf(`&%s=%s`, key, value)
-				} else {
-					sqlStatement = sqlStatement + fmt.Sprintf(`
-									card_name ILIKE %s OR description ILIKE %s
-									`, filter, filter)
-					filterUrl = filterUrl + fmt.Sprintf(`%s=%s`, key, value)
-					edited = true
-				}
-
-			case "linkmarkers":
-				var newFilter string
-
-				linkmark := strings.ReplaceAll(value, `"`, `'`)
-				newFilter = fmt.Sprintf("AND %s @> ARRAY[%s]::text[]", key, linkmark)
-
-				if edited {
-					filterUrl = filterUrl + fmt.Sprintf(`&%s=%s`, key, value)
-				} else {
-					newFilter = fmt.Sprintf("%s @> ARRAY[%s]::text[]", key, linkmark)
-					filterUrl = filterUrl + fmt.Sprintf(`%s=%s`, key, value)
-					edited = true
-				}
-
-				sqlStatement = sqlStatement + newFilter
-			default:
-				exists := false
-				for _, val := range arrayOfExacts {
-					if key == val {
-						exists = true
-					}
-				}
-
-				if !exists {
-					value = strings.ReplaceAll(value, `"`, "")
-					filter := "'" + value + "%'"
-
-					if edited {
-						sqlStatement = sqlStatement + fmt.Sprintf(`
-										AND %s ILIKE %s
-										`, key, filter)
-						filterUrl = filterUrl + fmt.Sprintf(`&%s=%s`, key, value)
-					} else {
-						sqlStatement = sqlStatement + fmt.Sprintf(`
-										%s ILIKE %s
-										`, key, filter)
-						filterUrl = filterUrl + fmt.Sprintf(`%s=%s`, key, value)
-						edited = true
-					}
-				}
+	switch statementType {
+	case "filter", "countFilter":
+		if filterMap["q"] != "" {
+			if err := queryFilter(q, filterMap["q"]); checkErr(err) {
+				return "", nil, "", err
 			}
 		}
 
-		// If it is the end of the loop
-		if i == len(filterMap) {
-			if mode != "count" {
-				sqlStatement = sqlStatement + fmt.Sprintf(` 
-				LIMIT %d OFFSET %d) as Q, 
-				LEFT JOIN %s ban on Q.id = card_id,
-				CROSS JOIN LATERAL (
-					SELECT array_agg(image_url::text) as image_url, array_agg(image_url_small::text) as image_url_small
-					FROM %s ci
-					WHERE ci.card_id = Q.id
-				) as L`, limit, page, os.Getenv("BANLIST_TABLE_NAME"), os.Getenv("IMAGES_TABLE_NAME"))
-			}
+		params, err := applyCardFilters(q, filterMap)
+		if checkErr(err) {
+			return "", nil, "", err
+		}
 
-			filterUrl = filterUrl + "&"
+		filterUrl := "/cards/filter/?"
+		if filterMap["q"] != "" {
+			filterUrl = filterUrl + "q=" + url.QueryEscape(filterMap["q"]) + "&"
+		}
+		if params != "" {
+			filterUrl = filterUrl + params + "&"
 		}
-	}
 
-	return sqlStatement, filterUrl
-}
+		if statementType == "countFilter" {
+			sqlStatement := fmt.Sprintf(`SELECT COUNT(*) FROM %s %s`, os.Getenv("CARD_TABLE_NAME"), q.whereClause())
 
-func ExportJSONToDB(DB *sql.DB) error {
-	jsonFile, err := os.Open("cardinfo.json")
-	if checkErr(err) {
-		return err
-	}
+			return sqlStatement, q.args, filterUrl, nil
+		}
 
-	defer jsonFile.Close()
+		filterString := fmt.Sprintf(`
+		FROM (SELECT * FROM %s C %s %s LIMIT %s OFFSET %s) as Q
+		%s
+		`, os.Getenv("CARD_TABLE_NAME"), q.whereClause(), innerOrder, q.arg(limit), q.arg(page),
+			banlistJoin(q, filterMap["banlist_date"]))
 
-	byteVal, _ := io.ReadAll(jsonFile)
+		sqlStatement := baseSelect + filterString + baseJoins + outerOrder
 
-	var data dbConfig.DB
+		return sqlStatement, q.args, filterUrl, nil
+	case "get":
+		getString := fmt.Sprintf(`
+		FROM (SELECT * FROM %s C %s LIMIT %s OFFSET %s) as Q
+		%s
+		`, os.Getenv("CARD_TABLE_NAME"), innerOrder, q.arg(limit), q.arg(page), banlistJoin(q, filterMap["banlist_date"]))
 
-	json.Unmarshal(byteVal, &data)
+		sqlStatement := baseSelect + getString + baseJoins + outerOrder
 
-	// add every card to the database
-	for i := 0; i < len(data.Cards); i++ {
-		AddCardToDB(data.Cards[i], DB)
-	}
+		return sqlStatement, q.args, baseUrl, nil
+	case "getById":
+		getIdString := fmt.Sprintf(`
+		FROM (SELECT * FROM %s WHERE id = %s) as Q
+		%s`,
+			os.Getenv("CARD_TABLE_NAME"), q.arg(atoiOrZero(filterMap["id"])), banlistJoin(q, filterMap["banlist_date"]))
 
-	return nil
-}
+		sqlStatement := baseSelect + getIdString + baseJoins
 
-func ExportBanlistJSONToDB(DB *sql.DB, mode string) error {
-	var jsonFile *os.File
-	var err error
+		return sqlStatement, q.args, baseUrl, nil
+	case "getByIds":
+		ids := []int64{}
+		for _, id := range strings.Split(filterMap["ids"], ",") {
+			ids = append(ids, int64(atoiOrZero(id)))
+		}
 
-	if mode == "tcg" {
-		jsonFile, err = os.Open("banlist.json")
-	} else {
-		jsonFile, err = os.Open("banlistocg.json")
-	}
+		getIdsString := fmt.Sprintf(`
+		FROM (SELECT * FROM %s WHERE id = ANY(%s::int[])) as Q
+		%s`,
+			os.Getenv("CARD_TABLE_NAME"), q.arg(pq.Int64Array(ids)), banlistJoin(q, filterMap["banlist_date"]))
 
-	if checkErr(err) {
-		return err
-	}
+		sqlStatement := baseSelect + getIdsString + baseJoins + " ORDER BY Q.card_name"
 
-	defer jsonFile.Close()
+		return sqlStatement, q.args, baseUrl, nil
+	case "postBanlist":
+		sqlStatement := fmt.Sprintf(`INSERT INTO %s (version_id, card_id, status) VALUES ($1, $2, $3)`, filterMap["table"])
 
-	byteVal, _ := io.ReadAll(jsonFile)
+		return sqlStatement, nil, baseUrl, nil
 
-	var data dbConfig.BanlistDB
+	case "getBanlist":
+		getBanlistString := fmt.Sprintf(`
+			FROM (SELECT * FROM %s) as Q
+			JOIN %s entry on Q.id = entry.card_id AND entry.version_id = %s
+			%s
+		`, os.Getenv("CARD_TABLE_NAME"), os.Getenv("BANLIST_ENTRIES_TABLE_NAME"),
+			q.arg(atoiOrZero(filterMap["version_id"])), banlistJoin(q, filterMap["banlist_date"]))
 
-	json.Unmarshal(byteVal, &data)
+		sqlStatement := baseSelect + getBanlistString + baseJoins + outerOrder
+		return sqlStatement, q.args, baseUrl, nil
+	case "count":
+		sqlStatement := fmt.Sprintf(`SELECT COUNT(*) FROM %s`, os.Getenv("CARD_TABLE_NAME"))
 
-	for i := 0; i < len(data.List); i++ {
-		AddBanlistToDB(data.List[i], DB, mode)
+		return sqlStatement, nil, baseUrl, nil
 	}
 
-	return nil
+	return "", nil, "", fmt.Errorf("unknown statement %q", statementType)
+}
+
+// imagesAggregate collects every artwork of the card Q as a JSON array, the
+// card's own passcode first and alternate artworks after it.
+func imagesAggregate() string {
+	return fmt.Sprintf(`
+		SELECT json_agg(json_build_object(
+			'id', ci.id,
+			'image_url', ci.image_url,
+			'image_url_small', ci.image_url_small,
+			'image_url_cropped', ci.image_url_cropped
+		) ORDER BY ci.id <> Q.id, ci.id) as card_images
+		FROM %s ci
+		WHERE ci.card_id = Q.id`, os.Getenv("IMAGES_TABLE_NAME"))
 }
 
 func checkErr(err error) bool {
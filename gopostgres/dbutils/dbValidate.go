@@ -0,0 +1,294 @@
+package dbutils
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	dbConfig "Yu-Go-Oh-API/gopostgres/dbconfig"
+
+	pq "github.com/lib/pq"
+)
+
+// ValidateCardsJSON checks every card of a dump without writing anything.
+// Entries that do not decode are reported like any other invalid card; only
+// a dump that is not valid JSON at all returns an error.
+func ValidateCardsJSON(path string) (dbConfig.ValidationReport, error) {
+	report := dbConfig.ValidationReport{Issues: []dbConfig.ValidationIssue{}}
+	seenCards := map[int]bool{}
+	seenImages := map[int]int{}
+
+	err := walkDataArray(path, func(dec *json.Decoder) error {
+		var card dbConfig.CardDB
+		index := report.Checked
+		report.Checked++
+
+		err := dec.Decode(&card)
+
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			report.Invalid++
+			report.Issues = append(report.Issues, dbConfig.ValidationIssue{
+				Index: index, ID: card.ID, Name: card.Card_Name, Field: typeErr.Field, Message: typeErr.Error(),
+			})
+			return nil
+		} else if checkErr(err) {
+			return err
+		}
+
+		issues := validateCard(card, index, seenCards, seenImages)
+		if len(issues) > 0 {
+			report.Invalid++
+			report.Issues = append(report.Issues, issues...)
+		} else {
+			report.Valid++
+		}
+
+		return nil
+	})
+
+	return report, err
+}
+
+func ValidateBanlistJSON(path string) (dbConfig.ValidationReport, error) {
+	report := dbConfig.ValidationReport{Issues: []dbConfig.ValidationIssue{}}
+	seen := map[int]bool{}
+
+	err := walkDataArray(path, func(dec *json.Decoder) error {
+		var banlist dbConfig.BanlistJSON
+		index := report.Checked
+		report.Checked++
+
+		err := dec.Decode(&banlist)
+
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			report.Invalid++
+			report.Issues = append(report.Issues, dbConfig.ValidationIssue{
+				Index: index, ID: banlist.ID, Field: typeErr.Field, Message: typeErr.Error(),
+			})
+			return nil
+		} else if checkErr(err) {
+			return err
+		}
+
+		issues := validateBanlist(banlist, index, seen)
+		if len(issues) > 0 {
+			report.Invalid++
+			report.Issues = append(report.Issues, issues...)
+		} else {
+			report.Valid++
+		}
+
+		return nil
+	})
+
+	return report, err
+}
+
+// validateCardFile builds the validation of a card file that is not JSON:
+// read has already parsed every entry, so only the card checks are left.
+func validateCardFile(read CardReader) func(path string) (dbConfig.ValidationReport, error) {
+	return func(path string) (dbConfig.ValidationReport, error) {
+		report := dbConfig.ValidationReport{Issues: []dbConfig.ValidationIssue{}}
+		seenCards := map[int]bool{}
+		seenImages := map[int]int{}
+
+		_, err := read(path, func(cards []dbConfig.CardDB) error {
+			for _, card := range cards {
+				issues := validateCard(card, report.Checked, seenCards, seenImages)
+				report.Checked++
+
+				if len(issues) > 0 {
+					report.Invalid++
+					report.Issues = append(report.Issues, issues...)
+				} else {
+					report.Valid++
+				}
+			}
+
+			return nil
+		})
+
+		return report, err
+	}
+}
+
+// validateBanlistFile is validateCardFile for banlist files.
+func validateBanlistFile(read BanlistReader) func(path string) (dbConfig.ValidationReport, error) {
+	return func(path string) (dbConfig.ValidationReport, error) {
+		report := dbConfig.ValidationReport{Issues: []dbConfig.ValidationIssue{}}
+		seen := map[int]bool{}
+
+		_, err := read(path, func(banlist dbConfig.BanlistJSON) error {
+			issues := validateBanlist(banlist, report.Checked, seen)
+			report.Checked++
+
+			if len(issues) > 0 {
+				report.Invalid++
+				report.Issues = append(report.Issues, issues...)
+			} else {
+				report.Valid++
+			}
+
+			return nil
+		})
+
+		return report, err
+	}
+}
+
+func validateCard(card dbConfig.CardDB, index int, seenCards map[int]bool, seenImages map[int]int) []dbConfig.ValidationIssue {
+	issues := []dbConfig.ValidationIssue{}
+	addIssue := func(field string, message string) {
+		issues = append(issues, dbConfig.ValidationIssue{
+			Index: index, ID: card.ID, Name: card.Card_Name, Field: field, Message: message,
+		})
+	}
+
+	if card.ID <= 0 {
+		addIssue("id", "is required")
+	} else if seenCards[card.ID] {
+		addIssue("id", "is duplicated")
+	}
+	seenCards[card.ID] = true
+
+	if strings.TrimSpace(card.Card_Name) == "" {
+		addIssue("card_name", "is required")
+	}
+
+	if strings.TrimSpace(card.Card_Type) == "" {
+		addIssue("card_type", "is required")
+	}
+
+	isMonster := strings.Contains(card.Card_Type, "Monster")
+	isSpellOrTrap := card.Card_Type == "Spell Card" || card.Card_Type == "Trap Card"
+	isLink := strings.Contains(card.Card_Type, "Link")
+
+	if card.Attr.Valid && !contains(dbConfig.Attributes, card.Attr.String) {
+		addIssue("attribute", fmt.Sprintf("unknown attribute %q", card.Attr.String))
+	} else if isMonster && !card.Attr.Valid {
+		addIssue("attribute", "is required for monsters")
+	}
+
+	if card.Race.Valid {
+		if isMonster && !contains(dbConfig.MonsterRaces, card.Race.String) {
+			addIssue("race", fmt.Sprintf("unknown monster race %q", card.Race.String))
+		} else if isSpellOrTrap && !contains(dbConfig.SpellTrapRaces, card.Race.String) {
+			addIssue("race", fmt.Sprintf("unknown spell/trap race %q", card.Race.String))
+		}
+	}
+
+	if !isLink && len(card.Linkmarkers) > 0 {
+		addIssue("linkmarkers", "only Link monsters have link markers")
+	}
+
+	if !isLink && card.Linkval.Valid {
+		addIssue("linkval", "only Link monsters have a link rating")
+	}
+
+	if len(card.Images) == 0 {
+		addIssue("card_images", "at least one image is required")
+	}
+
+	for _, image := range card.Images {
+		if image.ID <= 0 {
+			addIssue("card_images", "image id is required")
+		} else if owner, ok := seenImages[image.ID]; ok {
+			addIssue("card_images", fmt.Sprintf("image id %d is already used by card %d", image.ID, owner))
+		} else {
+			seenImages[image.ID] = card.ID
+		}
+
+		if image.Image_url == "" || image.Image_url_small == "" {
+			addIssue("card_images", fmt.Sprintf("image %d is missing a url", image.ID))
+		}
+	}
+
+	return issues
+}
+
+func validateBanlist(banlist dbConfig.BanlistJSON, index int, seen map[int]bool) []dbConfig.ValidationIssue {
+	issues := []dbConfig.ValidationIssue{}
+	addIssue := func(field string, message string) {
+		issues = append(issues, dbConfig.ValidationIssue{
+			Index: index, ID: banlist.ID, Field: field, Message: message,
+		})
+	}
+
+	if banlist.ID <= 0 {
+		addIssue("id", "is required")
+	} else if seen[banlist.ID] {
+		addIssue("id", "is duplicated")
+	}
+	seen[banlist.ID] = true
+
+	if len(banlist.BanlistInfo) == 0 {
+		addIssue("banlist_info", "is required")
+	}
+
+	for format, status := range banlist.BanlistInfo {
+		if !contains(dbConfig.BanlistStatuses, status) {
+			addIssue("banlist_info", fmt.Sprintf("unknown %s status %q", format, status))
+		}
+	}
+
+	return issues
+}
+
+// unknownBanlistCards reports the entries of a banlist file naming a
+// passcode no loaded card has, which the entries' foreign key would reject.
+func unknownBanlistCards(DB *sql.DB, path string, read BanlistReader) ([]dbConfig.ValidationIssue, error) {
+	issues := []dbConfig.ValidationIssue{}
+	ids := []int64{}
+	indexes := map[int]int{}
+
+	_, err := read(path, func(banlist dbConfig.BanlistJSON) error {
+		indexes[banlist.ID] = len(ids)
+		ids = append(ids, int64(banlist.ID))
+
+		return nil
+	})
+	if checkErr(err) {
+		return issues, err
+	}
+
+	query, err := DB.Query(fmt.Sprintf(`
+		SELECT u.id FROM unnest($1::int[]) as u(id)
+		WHERE NOT EXISTS (SELECT 1 FROM %s C WHERE C.id = u.id)
+		ORDER BY u.id`, os.Getenv("CARD_TABLE_NAME")), pq.Int64Array(ids))
+	if checkErr(err) {
+		return issues, err
+	}
+	defer query.Close()
+
+	for query.Next() {
+		var id int
+		if err := query.Scan(&id); checkErr(err) {
+			return issues, err
+		}
+
+		issues = append(issues, dbConfig.ValidationIssue{
+			Index: indexes[id], ID: id, Field: "id", Message: "is not a loaded card, skipped",
+		})
+	}
+
+	return issues, query.Err()
+}
+
+func contains(values []string, value string) bool {
+	for _, val := range values {
+		if val == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func issueError(issue dbConfig.ValidationIssue) error {
+	return fmt.Errorf("entry %d (id %d %s): %s %s", issue.Index, issue.ID, issue.Name, issue.Field, issue.Message)
+}
@@ -0,0 +1,99 @@
+package dbutils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	dbConfig "Yu-Go-Oh-API/gopostgres/dbconfig"
+)
+
+// writeTemp writes content to a file of the test's temporary directory.
+func writeTemp(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// issueFields lists the id and field of each issue, in order.
+func issueFields(issues []dbConfig.ValidationIssue) [][2]interface{} {
+	fields := [][2]interface{}{}
+	for _, issue := range issues {
+		fields = append(fields, [2]interface{}{issue.ID, issue.Field})
+	}
+
+	return fields
+}
+
+func TestValidateCardsJSON(t *testing.T) {
+	path := writeTemp(t, "cardinfo.json", `{"data": [
+		{"id": 1, "card_name": "Dark Magician", "card_type": "Normal Monster", "attribute": "DARK", "race": "Spellcaster",
+			"card_images": [{"id": 1, "image_url": "a", "image_url_small": "b"}]},
+		{"id": 1, "card_name": "", "card_type": "Effect Monster", "attribute": "SHADOW", "race": "Dragon",
+			"linkmarkers": ["Top"], "card_images": [{"id": 1, "image_url": "a"}]},
+		{"id": 2, "card_name": 5, "card_type": "Spell Card"},
+		{"id": 3, "card_name": "Pot of Greed", "card_type": "Spell Card", "race": "Warrior",
+			"card_images": [{"id": 3, "image_url": "a", "image_url_small": "b"}]},
+		{"id": 4, "card_name": "Decode Talker", "card_type": "Link Monster", "attribute": "DARK", "race": "Cyberse",
+			"linkval": 3, "linkmarkers": ["Top", "Bottom-Left", "Bottom-Right"],
+			"card_images": [{"id": 4, "image_url": "a", "image_url_small": "b"}]}
+	]}`)
+
+	report, err := ValidateCardsJSON(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if report.Checked != 5 || report.Valid != 2 || report.Invalid != 3 {
+		t.Errorf("checked, valid, invalid = %d, %d, %d, want 5, 2, 3", report.Checked, report.Valid, report.Invalid)
+	}
+
+	want := [][2]interface{}{
+		{1, "id"}, {1, "card_name"}, {1, "attribute"}, {1, "linkmarkers"}, {1, "card_images"}, {1, "card_images"},
+		{2, "card_name"},
+		{3, "race"},
+	}
+	if got := issueFields(report.Issues); !reflect.DeepEqual(got, want) {
+		t.Errorf("issues = %v, want %v", got, want)
+	}
+
+	if report.Issues[0].Index != 1 || report.Issues[6].Index != 2 {
+		t.Errorf("issue indexes = %d, %d, want 1, 2", report.Issues[0].Index, report.Issues[6].Index)
+	}
+}
+
+func TestValidateBanlistJSON(t *testing.T) {
+	path := writeTemp(t, "banlist.json", `{"data": [
+		{"id": 1, "banlist_info": {"ban_tcg": "Forbidden"}},
+		{"id": 1, "banlist_info": {"ban_tcg": "Limited"}},
+		{"id": 0, "banlist_info": {}},
+		{"id": 2, "banlist_info": {"ban_ocg": "Banned"}}
+	]}`)
+
+	report, err := ValidateBanlistJSON(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if report.Checked != 4 || report.Valid != 1 || report.Invalid != 3 {
+		t.Errorf("checked, valid, invalid = %d, %d, %d, want 4, 1, 3", report.Checked, report.Valid, report.Invalid)
+	}
+
+	want := [][2]interface{}{{1, "id"}, {0, "id"}, {0, "banlist_info"}, {2, "banlist_info"}}
+	if got := issueFields(report.Issues); !reflect.DeepEqual(got, want) {
+		t.Errorf("issues = %v, want %v", got, want)
+	}
+}
+
+func TestValidateRejectsFilesThatAreNotJSON(t *testing.T) {
+	path := writeTemp(t, "cardinfo.json", `{"data": [{"id": 1,`)
+
+	if _, err := ValidateCardsJSON(path); err == nil {
+		t.Errorf("expected an error")
+	}
+}
@@ -1,13 +1,19 @@
 package main
 
 import (
+	"bytes"
 	"database/sql"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"strconv"
+	"strings"
 
 	dbConfig "Yu-Go-Oh-API/gopostgres/dbconfig"
+	dbJobs "Yu-Go-Oh-API/gopostgres/dbjobs"
+	dbMigrate "Yu-Go-Oh-API/gopostgres/dbmigrate"
 	dbpaginate "Yu-Go-Oh-API/gopostgres/dbpaginate"
 	dbUtils "Yu-Go-Oh-API/gopostgres/dbutils"
 
@@ -18,6 +24,12 @@ import (
 
 var DB *sql.DB
 
+// Full card dumps are far larger than fiber's default 4MB body limit, which
+// every route but the loads keeps
+const uploadLimit = 512 * 1024 * 1024
+
+var errUploadTooLarge = errors.New("upload too large")
+
 func main() {
 	err := godotenv.Load()
 	if err != nil {
@@ -38,7 +50,46 @@ func main() {
 
 	println("Connected to database")
 
-	app := fiber.New()
+	// "migrate up|down|status" manages the schema and exits without serving
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		migrateCommand(DB, os.Args[2:])
+		return
+	}
+
+	if os.Getenv("AUTO_MIGRATE") != "false" {
+		version, err := dbMigrate.Migrate(DB)
+		checkErr(err)
+
+		fmt.Printf("Database schema at version %d \n", version)
+	}
+
+	if err := dbUtils.BuildAutocompleteIndex(DB); err != nil {
+		fmt.Printf("Autocomplete index not built: %s \n", err)
+	}
+
+	// Bodies are streamed so uploads go to disk instead of memory; fiber no
+	// longer enforces BodyLimit then, so bodyLimit does
+	app := fiber.New(fiber.Config{
+		StreamRequestBody: true,
+	})
+
+	app.Use(bodyLimit)
+
+	app.Get("/migrations", func(c *fiber.Ctx) error {
+		json := map[string]interface{}{}
+		statuses, err := dbMigrate.Status(DB)
+
+		if err != nil {
+			json["status"] = 500
+			json["error"] = err.Error()
+			return c.JSON(json)
+		}
+
+		json["status"] = 200
+		json["data"] = statuses
+
+		return c.JSON(json)
+	})
 
 	app.Get("/cards/", func(c *fiber.Ctx) error {
 		page, err := strconv.Atoi(c.Query("page"))
@@ -54,19 +105,40 @@ func main() {
 		filterMap := map[string]string{
 			"card_name":  "",
 			"card_level": "",
+			"sort":       c.Query("sort"),
+		}
+
+		banlistDate := c.Query("banlist_date")
+		if banlistDate != "" {
+			filterMap["banlist_date"] = banlistDate
 		}
 
 		json := map[string]interface{}{}
 
 		slice, err := dbUtils.GetCardsInDB(DB, filterMap, page, qSize, "get")
 
+		var filterErr *dbUtils.FilterError
+		if errors.As(err, &filterErr) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  400,
+				"message": filterErr.Error(),
+			})
+		}
+
+		if err != nil {
+			json["status"] = 500
+			json["error"] = err.Error()
+			return c.JSON(json)
+		}
+
+		count, url, err := dbUtils.GetCount(DB, filterMap, "get")
+
 		if err != nil {
 			json["status"] = 500
 			json["error"] = err.Error()
 			return c.JSON(json)
 		}
 
-		count, url := dbUtils.GetCount(DB, filterMap, "get")
 		pag := dbpaginate.Paginate(slice, page, qSize, count, url)
 
 		json["status"] = 200
@@ -75,17 +147,73 @@ func main() {
 		return c.JSON(json)
 	})
 
-	app.Get("/cards/load", func(c *fiber.Ctx) error {
-		err := dbUtils.ExportJSONToDB(DB)
+	loadCards := func(c *fiber.Ctx) error {
+		mode := loadMode(c)
+
+		upload, err := saveUpload(c)
+		if err == errUploadTooLarge {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+				"status":  413,
+				"message": fmt.Sprintf("Upload over %d bytes", uploadLimit),
+			})
+		}
 
 		if err != nil {
 			return c.JSON(fiber.Map{
 				"status":  500,
-				"message": "Error loading cards",
+				"message": "Error reading upload",
 			})
 		}
-		return c.SendString("Done")
-	})
+
+		// ?format=cdb reads a YGOPro/EDOPro cards.cdb instead of JSON
+		cdb := c.Query("format") == "cdb"
+
+		job, err := dbJobs.Start("cards", func(job *dbJobs.Job) (interface{}, error) {
+			path := dbUtils.CardsJSONPath()
+			if cdb {
+				path = dbUtils.CardsCDBPath()
+			}
+
+			if upload != "" {
+				path = upload
+				defer os.Remove(upload)
+			}
+
+			var result interface{}
+			var err error
+			if cdb {
+				result, err = dbUtils.LoadCardsCDB(DB, path, mode, job)
+			} else {
+				result, err = dbUtils.LoadCardsJSON(DB, path, mode, job)
+			}
+
+			// Completions follow the card table, even after a partial import
+			if indexErr := dbUtils.BuildAutocompleteIndex(DB); indexErr != nil {
+				job.AddError(indexErr)
+			}
+
+			return result, err
+		})
+
+		if err == dbJobs.ErrJobRunning {
+			if upload != "" {
+				os.Remove(upload)
+			}
+
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"status":  409,
+				"message": "A card load is already running",
+			})
+		}
+
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"status": 202,
+			"data":   job.Status(),
+		})
+	}
+
+	app.Get("/cards/load", loadCards)
+	app.Post("/cards/load", loadCards)
 
 	app.Get("/cards/filter/", func(c *fiber.Ctx) error {
 		name := c.Query("card_name")
@@ -99,8 +227,41 @@ func main() {
 		scale := c.Query("card_scale")
 		atk := c.Query("atk")
 		def := c.Query("def")
+		frameType := c.Query("frame_type")
+		typeline := c.Query("typeline")
+		konamiId := c.Query("konami_id")
+		tcgDate := c.Query("tcg_date")
+		ocgDate := c.Query("ocg_date")
+		hasEffect := c.Query("has_effect")
+		formats := c.Query("formats")
+		setCode := c.Query("set_code")
+		rarity := c.Query("rarity")
+		minPrice := c.Query("min_price")
+		maxPrice := c.Query("max_price")
+
+		arrayOfParams := []string{
+			name, level, archetype, attribute, cardType, race, linkval, linkmark, scale, atk, def,
+			frameType, typeline, konamiId, tcgDate, ocgDate, hasEffect, formats, setCode, rarity,
+			minPrice, maxPrice, c.Query("q"),
+		}
+
+		// Comparisons like atk_gte and negations like not_race
+		extraFilters := map[string]string{}
+		extraKeys := append(dbUtils.RangeFilterKeys(), dbUtils.NegatedFilterKeys()...)
+		for _, key := range extraKeys {
+			if value := c.Query(key); value != "" {
+				extraFilters[key] = value
+				arrayOfParams = append(arrayOfParams, value)
+			}
+		}
 
-		arrayOfParams := []string{name, level, archetype, attribute, cardType, race, linkval, linkmark, scale, atk, def}
+		// Banlist statuses like tcg_status, for every registered format
+		c.Context().QueryArgs().VisitAll(func(key []byte, value []byte) {
+			if _, ok := dbUtils.BanlistStatusKey(string(key)); ok && len(value) > 0 {
+				extraFilters[string(key)] = string(value)
+				arrayOfParams = append(arrayOfParams, string(value))
+			}
+		})
 
 		noFilter := true
 		for i := 0; i < len(arrayOfParams); i++ {
@@ -116,8 +277,8 @@ func main() {
 		}
 
 		page, err := strconv.Atoi(c.Query("page"))
-		if err != nil || (page < 0) {
-			page = 0
+		if err != nil || (page <= 0) {
+			page = 1
 		}
 
 		qSize, err := strconv.Atoi(c.Query("query_size"))
@@ -137,18 +298,76 @@ func main() {
 			"card_scale":  scale,
 			"atk":         atk,
 			"def":         def,
+			"frame_type":  frameType,
+			"typeline":    typeline,
+			"konami_id":   konamiId,
+			"tcg_date":    tcgDate,
+			"ocg_date":    ocgDate,
+			"has_effect":  hasEffect,
+			"formats":     formats,
+			"set_code":    setCode,
+			"rarity":      rarity,
+			"min_price":   minPrice,
+			"max_price":   maxPrice,
+			"sort":        c.Query("sort"),
+			"q":           c.Query("q"),
+		}
+
+		for key, value := range extraFilters {
+			filterMap[key] = value
+		}
+
+		if minPrice != "" || maxPrice != "" {
+			filterMap["price_vendor"] = c.Query("price_vendor")
+		}
+
+		banlistDate := c.Query("banlist_date")
+		if banlistDate != "" {
+			filterMap["banlist_date"] = banlistDate
 		}
 
 		json := map[string]interface{}{}
 		slice, err := dbUtils.GetCardsInDB(DB, filterMap, page, qSize, "filter")
 
+		var queryErr *dbUtils.QueryError
+		if errors.As(err, &queryErr) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":   400,
+				"message":  queryErr.Error(),
+				"position": queryErr.Position,
+			})
+		}
+
+		var formatErr *dbUtils.UnknownFormatError
+		if errors.As(err, &formatErr) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  400,
+				"message": formatErr.Error(),
+			})
+		}
+
+		var filterErr *dbUtils.FilterError
+		if errors.As(err, &filterErr) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  400,
+				"message": filterErr.Error(),
+			})
+		}
+
+		if err != nil {
+			json["status"] = 500
+			json["error"] = err.Error()
+			return c.JSON(json)
+		}
+
+		count, url, err := dbUtils.GetCount(DB, filterMap, "filter")
+
 		if err != nil {
 			json["status"] = 500
 			json["error"] = err.Error()
 			return c.JSON(json)
 		}
 
-		count, url := dbUtils.GetCount(DB, filterMap, "filter")
 		pag := dbpaginate.Paginate(slice, page, qSize, count, url)
 
 		json["status"] = 200
@@ -157,6 +376,120 @@ func main() {
 		return c.JSON(json)
 	})
 
+	// Registered before /cards/:id, which would otherwise match "search"
+	app.Get("/cards/search", func(c *fiber.Ctx) error {
+		if strings.TrimSpace(c.Query("q")) == "" {
+			return c.JSON(fiber.Map{
+				"status":  500,
+				"message": "Pass the words to search for as q",
+			})
+		}
+
+		page, err := strconv.Atoi(c.Query("page"))
+		if err != nil || (page <= 0) {
+			page = 1
+		}
+
+		qSize, err := strconv.Atoi(c.Query("query_size"))
+		if err != nil || (qSize <= 0) || (qSize > 20) {
+			qSize = 20
+		}
+
+		// Every card filter applies to the search as well; unknown keys are
+		// ignored by the query builder
+		filterMap := map[string]string{}
+		c.Context().QueryArgs().VisitAll(func(key []byte, value []byte) {
+			filterMap[string(key)] = string(value)
+		})
+
+		json := map[string]interface{}{}
+		results, err := dbUtils.SearchCards(DB, filterMap, page, qSize)
+
+		var formatErr *dbUtils.UnknownFormatError
+		if errors.As(err, &formatErr) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  400,
+				"message": formatErr.Error(),
+			})
+		}
+
+		var filterErr *dbUtils.FilterError
+		if errors.As(err, &filterErr) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  400,
+				"message": filterErr.Error(),
+			})
+		}
+
+		if err != nil {
+			json["status"] = 500
+			json["error"] = err.Error()
+			return c.JSON(json)
+		}
+
+		count, url, err := dbUtils.GetSearchCount(DB, filterMap)
+
+		if err != nil {
+			json["status"] = 500
+			json["error"] = err.Error()
+			return c.JSON(json)
+		}
+
+		json["status"] = 200
+		json["data"] = dbpaginate.Paginate(results, page, qSize, count, url)
+
+		return c.JSON(json)
+	})
+
+	app.Get("/cards/autocomplete", func(c *fiber.Ctx) error {
+		limit, err := strconv.Atoi(c.Query("limit"))
+		if err != nil || (limit <= 0) || (limit > 50) {
+			limit = 10
+		}
+
+		json := map[string]interface{}{}
+		json["status"] = 200
+		json["data"] = dbUtils.Autocomplete(c.Query("q"), limit)
+
+		return c.JSON(json)
+	})
+
+	app.Get("/cards/lookup", func(c *fiber.Ctx) error {
+		name := strings.TrimSpace(c.Query("name"))
+		if name == "" {
+			return c.JSON(fiber.Map{
+				"status":  500,
+				"message": "Pass the card name to look up as name",
+			})
+		}
+
+		limit, err := strconv.Atoi(c.Query("limit"))
+		if err != nil || (limit <= 0) || (limit > 20) {
+			limit = 5
+		}
+
+		json := map[string]interface{}{}
+		lookup, err := dbUtils.LookupCardName(DB, name, limit, c.Query("banlist_date"))
+
+		if err == sql.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"status":  404,
+				"message": "No card name comes close to " + name,
+			})
+		}
+
+		if err != nil {
+			json["status"] = 500
+			json["error"] = err.Error()
+			return c.JSON(json)
+		}
+
+		json["status"] = 200
+		json["data"] = lookup
+
+		return c.JSON(json)
+	})
+
 	//get card by id
 	app.Get("/cards/:id", func(c *fiber.Ctx) error {
 		id := c.Params("id")
@@ -170,7 +503,7 @@ func main() {
 		}
 
 		json := map[string]interface{}{}
-		card, err := dbUtils.GetCardById(DB, integer)
+		card, err := dbUtils.GetCardById(DB, integer, c.Query("banlist_date"))
 
 		if err != nil {
 			json["status"] = 500
@@ -184,63 +517,489 @@ func main() {
 		return c.JSON(json)
 	})
 
-	app.Post("/banlist/load/:mode", func(c *fiber.Ctx) error {
-		mode := c.Params("mode")
+	app.Get("/cards/:id/prices", func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+
+		if err != nil {
+			return c.JSON(fiber.Map{
+				"status":  500,
+				"message": "Error parsing id",
+			})
+		}
+
+		json := map[string]interface{}{}
+		prices, err := dbUtils.GetCardPrices(DB, id)
+
+		if err != nil {
+			json["status"] = 500
+			json["error"] = err.Error()
+			return c.JSON(json)
+		}
+
+		json["status"] = 200
+		json["data"] = prices
+
+		return c.JSON(json)
+	})
+
+	app.Get("/sets", func(c *fiber.Ctx) error {
+		json := map[string]interface{}{}
+		sets, err := dbUtils.GetSets(DB)
+
+		if err != nil {
+			json["status"] = 500
+			json["error"] = err.Error()
+			return c.JSON(json)
+		}
+
+		json["status"] = 200
+		json["data"] = sets
+
+		return c.JSON(json)
+	})
+
+	app.Get("/sets/:code", func(c *fiber.Ctx) error {
+		json := map[string]interface{}{}
+		set, err := dbUtils.GetSetByCode(DB, c.Params("code"))
+
+		if err == sql.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"status":  404,
+				"message": "Set not found",
+			})
+		}
+
+		if err != nil {
+			json["status"] = 500
+			json["error"] = err.Error()
+			return c.JSON(json)
+		}
+
+		json["status"] = 200
+		json["data"] = set
+
+		return c.JSON(json)
+	})
+
+	app.Post("/banlist/load/:format", func(c *fiber.Ctx) error {
+		format := c.Params("format")
+
+		if _, err := dbUtils.GetBanlistFormat(DB, format); err != nil {
+			return c.JSON(fiber.Map{
+				"status":  500,
+				"message": "Invalid format",
+			})
+		}
+
+		writeMode := loadMode(c)
 
-		if mode != "tcg" && mode != "ocg" {
+		version, err := dbUtils.NewBanlistVersion(format, c.Query("name"), c.Query("date"))
+		if err != nil {
 			return c.JSON(fiber.Map{
 				"status":  500,
-				"message": "Invalid mode",
+				"message": err.Error(),
 			})
 		}
 
-		err := dbUtils.ExportBanlistJSONToDB(DB, mode)
+		upload, err := saveUpload(c)
+		if err == errUploadTooLarge {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+				"status":  413,
+				"message": fmt.Sprintf("Upload over %d bytes", uploadLimit),
+			})
+		}
 
 		if err != nil {
 			return c.JSON(fiber.Map{
 				"status":  500,
-				"message": "Error loading banlist",
+				"message": "Error reading upload",
+			})
+		}
+
+		// ?as=lflist reads an EDOPro/YGOPro lflist.conf instead of JSON
+		lflist := c.Query("as") == "lflist"
+		list := c.Query("list")
+
+		job, err := dbJobs.Start("banlist_"+format, func(job *dbJobs.Job) (interface{}, error) {
+			path := dbUtils.BanlistJSONPath(format)
+			if lflist {
+				path = dbUtils.LflistPath()
+			}
+
+			if upload != "" {
+				path = upload
+				defer os.Remove(upload)
+			}
+
+			if lflist {
+				return dbUtils.LoadBanlistLflist(DB, version, path, list, writeMode, job)
+			}
+
+			return dbUtils.LoadBanlistJSON(DB, version, path, writeMode, job)
+		})
+
+		if err == dbJobs.ErrJobRunning {
+			if upload != "" {
+				os.Remove(upload)
+			}
+
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"status":  409,
+				"message": "A load of this banlist format is already running",
 			})
 		}
-		return c.SendString("Done")
+
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"status": 202,
+			"data":   job.Status(),
+		})
+	})
+
+	app.Get("/jobs", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"status": 200,
+			"data":   dbJobs.List(),
+		})
 	})
 
-	app.Get("/banlist/:mode", func(c *fiber.Ctx) error {
-		mode := c.Params("mode")
+	app.Get("/jobs/:id", func(c *fiber.Ctx) error {
+		status, ok := dbJobs.Get(c.Params("id"))
 
-		if mode != "tcg" && mode != "ocg" {
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"status":  404,
+				"message": "Job not found",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"status": 200,
+			"data":   status,
+		})
+	})
+
+	app.Get("/banlist/formats", func(c *fiber.Ctx) error {
+		json := map[string]interface{}{}
+		formats, err := dbUtils.GetBanlistFormats(DB)
+
+		if err != nil {
+			json["status"] = 500
+			json["error"] = err.Error()
+			return c.JSON(json)
+		}
+
+		json["status"] = 200
+		json["data"] = formats
+
+		return c.JSON(json)
+	})
+
+	app.Post("/banlist/formats", func(c *fiber.Ctx) error {
+		format, err := dbUtils.CreateBanlistFormat(DB, dbConfig.BanlistFormat{Code: c.Query("code"), Name: c.Query("name")})
+
+		var codeErr *dbUtils.FormatCodeError
+		if errors.As(err, &codeErr) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  400,
+				"message": codeErr.Error(),
+			})
+		}
+
+		if err != nil {
 			return c.JSON(fiber.Map{
 				"status":  500,
-				"message": "Invalid mode",
+				"message": err.Error(),
 			})
 		}
 
-		filterMap := map[string]string{
-			"table": os.Getenv("BANLIST_TABLE_NAME"),
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"status": 201,
+			"data":   format,
+		})
+	})
+
+	// Registered before /banlist/:format, which would otherwise match "diff"
+	// and "formats"; CreateBanlistFormat refuses those codes
+	app.Get("/banlist/diff", func(c *fiber.Ctx) error {
+		var from, to dbConfig.BanlistVersion
+		var err error
+
+		json := map[string]interface{}{}
+
+		if compare := c.Query("compare"); compare != "" {
+			formats := strings.Split(compare, "-")
+			if len(formats) != 2 {
+				return c.JSON(fiber.Map{
+					"status":  500,
+					"message": "compare takes two formats, like compare=tcg-ocg",
+				})
+			}
+
+			from, err = dbUtils.ResolveBanlistVersion(DB, formats[0], c.Query("date"), "")
+			if err == nil {
+				to, err = dbUtils.ResolveBanlistVersion(DB, formats[1], c.Query("date"), "")
+			}
+		} else {
+			if c.Query("from") == "" || c.Query("to") == "" {
+				return c.JSON(fiber.Map{
+					"status":  500,
+					"message": "Pass from and to versions, or compare=tcg-ocg",
+				})
+			}
+
+			from, err = dbUtils.FindBanlistVersion(DB, c.Query("from"))
+			if err == nil {
+				to, err = dbUtils.FindBanlistVersion(DB, c.Query("to"))
+			}
+		}
+
+		if err == sql.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"status":  404,
+				"message": "No banlist version matches",
+			})
 		}
 
-		if mode == "ocg" {
-			filterMap["table"] = os.Getenv("OCG_BANLIST_TABLE_NAME")
+		if err != nil {
+			json["status"] = 500
+			json["error"] = err.Error()
+			return c.JSON(json)
+		}
+
+		diff, err := dbUtils.DiffBanlists(DB, from, to)
+
+		if err != nil {
+			json["status"] = 500
+			json["error"] = err.Error()
+			return c.JSON(json)
+		}
+
+		json["status"] = 200
+		json["data"] = diff
+
+		return c.JSON(json)
+	})
+
+	app.Get("/banlist/:format", func(c *fiber.Ctx) error {
+		format := c.Params("format")
+
+		if _, err := dbUtils.GetBanlistFormat(DB, format); err != nil {
+			return c.JSON(fiber.Map{
+				"status":  500,
+				"message": "Invalid format",
+			})
 		}
 
 		json := map[string]interface{}{}
+		version, err := dbUtils.ResolveBanlistVersion(DB, format, c.Query("date"), c.Query("version"))
+
+		if err == sql.ErrNoRows {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"status":  404,
+				"message": "No banlist version matches",
+			})
+		}
+
+		if err != nil {
+			json["status"] = 500
+			json["error"] = err.Error()
+			return c.JSON(json)
+		}
+
+		filterMap := map[string]string{
+			"version_id":   strconv.Itoa(version.ID),
+			"banlist_date": version.Effective_date,
+			"sort":         c.Query("sort"),
+		}
+
 		banlist, err := dbUtils.GetCardsInDB(DB, filterMap, 0, 0, "getBanlist")
 
+		var filterErr *dbUtils.FilterError
+		if errors.As(err, &filterErr) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  400,
+				"message": filterErr.Error(),
+			})
+		}
+
 		if err != nil {
 			json["status"] = 500
 			json["error"] = err.Error()
 			return c.JSON(json)
 		}
 
+		if c.Query("as") == "lflist" {
+			c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+			c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.lflist.conf"`, version.Name))
+			return c.SendString(dbUtils.WriteLflist(version, banlist))
+		}
+
 		json["status"] = 200
+		json["version"] = version
 		json["data"] = banlist
 
 		return c.JSON(json)
 	})
 
+	app.Get("/banlist/:format/versions", func(c *fiber.Ctx) error {
+		format := c.Params("format")
+
+		if _, err := dbUtils.GetBanlistFormat(DB, format); err != nil {
+			return c.JSON(fiber.Map{
+				"status":  500,
+				"message": "Invalid format",
+			})
+		}
+
+		json := map[string]interface{}{}
+		versions, err := dbUtils.GetBanlistVersions(DB, format)
+
+		if err != nil {
+			json["status"] = 500
+			json["error"] = err.Error()
+			return c.JSON(json)
+		}
+
+		json["status"] = 200
+		json["data"] = versions
+
+		return c.JSON(json)
+	})
+
 	log.Fatal(app.Listen(":4000"))
 }
 
+// migrateCommand runs the migrate subcommand. Applying and rolling back
+// migrations is only possible from the command line, never over HTTP.
+func migrateCommand(DB *sql.DB, args []string) {
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	switch action {
+	case "up":
+		version, err := dbMigrate.Migrate(DB)
+		checkErr(err)
+
+		fmt.Printf("Database schema at version %d \n", version)
+	case "down":
+		version, err := dbMigrate.Rollback(DB)
+		checkErr(err)
+
+		fmt.Printf("Rolled back to version %d \n", version)
+	case "status":
+		statuses, err := dbMigrate.Status(DB)
+		checkErr(err)
+
+		for _, status := range statuses {
+			applied := "pending"
+			if status.Applied {
+				applied = "applied"
+			}
+
+			fmt.Printf("%3d  %-8s %s \n", status.Version, applied, status.Name)
+		}
+	default:
+		log.Fatalf("Unknown migrate command %q, expected up, down or status", action)
+	}
+}
+
+// loadMode picks how an import writes: "dryRun" only validates, "sync"
+// merges into the existing rows and "import" inserts everything.
+func loadMode(c *fiber.Ctx) string {
+	if c.Query("dry_run") == "true" {
+		return "dryRun"
+	}
+
+	if c.Query("sync") == "true" {
+		return "sync"
+	}
+
+	return "import"
+}
+
+// bodyLimit turns away requests announcing a body over the limit of their
+// route: uploadLimit for loads, fiber's default for everything else.
+func bodyLimit(c *fiber.Ctx) error {
+	limit := fiber.DefaultBodyLimit
+	if strings.HasPrefix(c.Path(), "/cards/load") || strings.HasPrefix(c.Path(), "/banlist/load/") {
+		limit = uploadLimit
+	}
+
+	if c.Request().Header.ContentLength() > limit {
+		// The unread body must not be taken for the next request
+		c.Context().SetConnectionClose()
+
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"status":  413,
+			"message": fmt.Sprintf("Request body over %d bytes", limit),
+		})
+	}
+
+	return c.Next()
+}
+
+// saveUpload stores the file sent with the request, either as the "file"
+// multipart field or as the raw body, in a temporary file so it outlives the
+// request. Both are streamed to disk rather than held in memory. It returns
+// an empty path when the request carries no data.
+func saveUpload(c *fiber.Ctx) (string, error) {
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEMultipartForm) {
+		// fasthttp already spooled the parts of large forms to disk
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			return "", err
+		}
+
+		if fileHeader.Size > uploadLimit {
+			return "", errUploadTooLarge
+		}
+
+		tmpFile, err := os.CreateTemp("", "ygo-upload-*")
+		if err != nil {
+			return "", err
+		}
+		tmpFile.Close()
+
+		if err := c.SaveFile(fileHeader, tmpFile.Name()); err != nil {
+			os.Remove(tmpFile.Name())
+			return "", err
+		}
+
+		return tmpFile.Name(), nil
+	}
+
+	if c.Request().Header.ContentLength() == 0 {
+		return "", nil
+	}
+
+	tmpFile, err := os.CreateTemp("", "ygo-upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer tmpFile.Close()
+
+	// Chunked bodies have no length to check up front, so the copy stops one
+	// byte past the limit to notice them
+	body := c.Context().RequestBodyStream()
+	if body == nil {
+		body = bytes.NewReader(c.Body())
+	}
+
+	written, err := io.Copy(tmpFile, io.LimitReader(body, uploadLimit+1))
+	if err == nil && written > uploadLimit {
+		err = errUploadTooLarge
+	}
+
+	if err != nil || written == 0 {
+		os.Remove(tmpFile.Name())
+		return "", err
+	}
+
+	return tmpFile.Name(), nil
+}
+
 func checkErr(err error) {
 	if err != nil {
 		panic(err.Error())